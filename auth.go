@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"fitbit-strava/auth"
+
+	"github.com/dustin/go-humanize"
+)
+
+// runAuth implements `fitbit-strava auth [provider...]`: authorize Fitbit
+// and Strava ahead of time, or again with -reset after a scope change, and
+// print the state of the saved tokens.
+func runAuth(args []string) int {
+	fs := flag.NewFlagSet("auth", flag.ExitOnError)
+	reset := fs.Bool("reset", false, "Discard the saved tokens and authorize again")
+	output := outputFlag(fs, "a JSON object of each provider's token status")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava auth [flags] [fitbit] [strava]")
+		fmt.Fprintln(os.Stderr, "Without providers, authorizes Fitbit and, if it is a destination, Strava.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	cfg, authenticator := loadAuth()
+	authenticator.Interactive = true
+	providers := fs.Args()
+	if len(providers) == 0 {
+		providers = []string{"fitbit"}
+		if cfg.HasDestination("strava") {
+			providers = append(providers, "strava")
+		}
+	}
+
+	for _, provider := range providers {
+		if provider != "fitbit" && provider != "strava" {
+			fmt.Fprintf(os.Stderr, "Unknown provider %q (want fitbit or strava)\n", provider)
+			return exitUsage
+		}
+	}
+
+	status := exitOK
+	statuses := make(map[string]auth.TokenStatus, len(providers))
+	for _, provider := range providers {
+		if *reset {
+			if err := authenticator.Store.DeleteToken(provider); err != nil {
+				return reportError(fmt.Errorf("failed to delete %s token: %v", provider, err))
+			}
+		}
+		switch provider {
+		case "fitbit":
+			newFitbitClient(cfg, authenticator)
+		case "strava":
+			newStravaClient(cfg, authenticator)
+		}
+
+		if *output == "json" {
+			statuses[provider] = authenticator.Status(provider)
+			if !statuses[provider].Valid {
+				status = exitAuth
+			}
+			continue
+		}
+		token := authenticator.Store.GetToken(provider)
+		switch {
+		case token == nil:
+			fmt.Printf("%s: not authorized\n", provider)
+			status = exitAuth
+		case token.RefreshToken != "":
+			fmt.Printf("%s: authorized (refreshes automatically)\n", provider)
+		case !token.Expiry.IsZero() && token.Expiry.Before(time.Now()):
+			fmt.Printf("%s: token expired %s; run `fitbit-strava auth -reset %s`\n", provider, humanize.Time(token.Expiry), provider)
+			status = exitAuth
+		default:
+			fmt.Printf("%s: authorized\n", provider)
+		}
+	}
+	if *output == "json" {
+		if err := printJSON(statuses); err != nil {
+			return reportError(err)
+		}
+	}
+	return status
+}
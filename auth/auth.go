@@ -2,33 +2,114 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
+	"fitbit-strava/logging"
+	"fitbit-strava/metrics"
+
 	"golang.org/x/oauth2"
 )
 
+// ErrAuthRequired is returned by requests made without a usable token: none
+// was saved and the authenticator can't ask for one, or the refresh token
+// was rejected.
+var ErrAuthRequired = errors.New("authorization required")
+
 type Authenticator struct {
 	Store *TokenStore
+	// Interactive allows starting the browser flow for a provider without a
+	// token. Otherwise its requests fail with ErrAuthRequired.
+	Interactive bool
+
+	mu sync.Mutex
+	// refreshErrs holds the last failed refresh of each provider, until one
+	// succeeds.
+	refreshErrs map[string]error
+}
+
+// TokenStatus says whether a provider's token can be used, as far as is
+// known without calling the API.
+type TokenStatus struct {
+	Valid  bool      `json:"valid"`
+	Expiry time.Time `json:"expiry,omitzero"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Status reports on the saved token of provider: missing, revoked, expired
+// without a refresh token, or rejected on its last refresh are invalid.
+func (a *Authenticator) Status(provider string) TokenStatus {
+	if err := a.checkRevoked(provider); err != nil {
+		return TokenStatus{Error: err.Error()}
+	}
+	token := a.Store.GetToken(provider)
+	if token == nil {
+		return TokenStatus{Error: "not authorized"}
+	}
+	status := TokenStatus{Expiry: token.Expiry}
+	a.mu.Lock()
+	err := a.refreshErrs[provider]
+	a.mu.Unlock()
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case !token.Valid() && token.RefreshToken == "":
+		status.Error = "expired"
+	default:
+		status.Valid = true
+	}
+	return status
+}
+
+// checkRevoked returns an error wrapping ErrAuthRequired if the user revoked
+// provider's access.
+func (a *Authenticator) checkRevoked(provider string) error {
+	at, ok := a.Store.RevokedAt(provider)
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("%w: %s access was revoked %s; run `fitbit-strava auth %s`",
+		ErrAuthRequired, provider, at.Format(time.RFC3339), provider)
+}
+
+func (a *Authenticator) setRefreshErr(provider string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.refreshErrs == nil {
+		a.refreshErrs = make(map[string]error)
+	}
+	if err == nil {
+		delete(a.refreshErrs, provider)
+	} else {
+		a.refreshErrs[provider] = err
+	}
 }
 
 func NewAuthenticator(store *TokenStore) *Authenticator {
-	return &Authenticator{Store: store}
+	return &Authenticator{Store: store, Interactive: true}
 }
 
 // GetClient returns an authenticated HTTP client for the given provider.
 // It handles token retrieval, refreshing, and initial authorization if needed.
 func (a *Authenticator) GetClient(ctx context.Context, provider string, config *oauth2.Config) *http.Client {
+	// API calls and token refreshes alike go through the logging transport.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: logging.NewTransport(provider, nil)})
 	token := a.Store.GetToken(provider)
 
 	// If no token exists, or if it's invalid (nil), start the auth flow
+	if token == nil && !a.Interactive {
+		return a.revocable(provider, oauth2.NewClient(ctx, missingTokenSource{provider: provider}))
+	}
 	if token == nil {
-		fmt.Printf("No existing token for %s. Starting authentication flow...\n", provider)
+		fmt.Fprintf(os.Stderr, "No existing token for %s. Starting authentication flow...\n", provider)
 		token = a.startAuthFlow(ctx, config)
 		if err := a.Store.SetToken(provider, token); err != nil {
-			log.Fatalf("Failed to save new token for %s: %v", provider, err)
+			logging.Fatal("Failed to save new token", "provider", provider, "error", err)
 		}
 	} else {
 		// Token exists, let's see if it needs refresh.
@@ -41,11 +122,35 @@ func (a *Authenticator) GetClient(ctx context.Context, provider string, config *
 	ts := config.TokenSource(ctx, token)
 	persistingTS := &persistingTokenSource{
 		src:      ts,
-		store:    a.Store,
+		auth:     a,
 		provider: provider,
+		last:     token.AccessToken,
 	}
 
-	return oauth2.NewClient(ctx, persistingTS)
+	return a.revocable(provider, oauth2.NewClient(ctx, persistingTS))
+}
+
+// revocable makes client fail every request once provider's access is
+// revoked, even if it still holds an access token.
+func (a *Authenticator) revocable(provider string, client *http.Client) *http.Client {
+	client.Transport = &revocableTransport{base: client.Transport, auth: a, provider: provider}
+	return client
+}
+
+type revocableTransport struct {
+	base     http.RoundTripper
+	auth     *Authenticator
+	provider string
+}
+
+func (t *revocableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.auth.checkRevoked(t.provider); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
 }
 
 func (a *Authenticator) startAuthFlow(ctx context.Context, config *oauth2.Config) *oauth2.Token {
@@ -69,15 +174,15 @@ func (a *Authenticator) startAuthFlow(ctx context.Context, config *oauth2.Config
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start local auth server: %v", err)
+			logging.Fatal("Failed to start local auth server", "error", err)
 		}
 	}()
 
 	// 2. Open browser
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("\n----------------------------------------------------------------\n")
-	fmt.Printf("Please authenticate by visiting this URL:\n%v\n", authURL)
-	fmt.Printf("----------------------------------------------------------------\n")
+	fmt.Fprintf(os.Stderr, "\n----------------------------------------------------------------\n")
+	fmt.Fprintf(os.Stderr, "Please authenticate by visiting this URL:\n%v\n", authURL)
+	fmt.Fprintf(os.Stderr, "----------------------------------------------------------------\n")
 
 	// 3. Wait for code
 	code := <-codeChan
@@ -92,7 +197,7 @@ func (a *Authenticator) startAuthFlow(ctx context.Context, config *oauth2.Config
 	// 4. Exchange code for token
 	token, err := config.Exchange(ctx, code)
 	if err != nil {
-		log.Fatalf("Failed to exchange token: %v", err)
+		logging.Fatal("Failed to exchange token", "error", err)
 	}
 
 	return token
@@ -101,21 +206,41 @@ func (a *Authenticator) startAuthFlow(ctx context.Context, config *oauth2.Config
 // persistingTokenSource wraps an oauth2.TokenSource to save the token whenever it's refreshed.
 type persistingTokenSource struct {
 	src      oauth2.TokenSource
-	store    *TokenStore
+	auth     *Authenticator
 	provider string
+	// last is the access token last saved.
+	last string
 }
 
 func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
 	token, err := s.src.Token()
 	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			s.auth.setRefreshErr(s.provider, retrieveErr)
+			return nil, fmt.Errorf("%w: refreshing the %s token failed: %v", ErrAuthRequired, s.provider, err)
+		}
 		return nil, err
 	}
-	// We could optimize this to only save if it changed, but saving is cheap here.
-	// However, we should be careful about locking. The store handles its own locking.
-	// Ideally we only save if the access token or refresh token changed.
-	// For now, let's just save it. logic is safe.
-	if err := s.store.SetToken(s.provider, token); err != nil {
-		fmt.Printf("Warning: Failed to persist refreshed token for %s: %v\n", s.provider, err)
+	s.auth.setRefreshErr(s.provider, nil)
+	if token.AccessToken == s.last {
+		return token, nil
 	}
+	slog.Debug("Refreshed access token", "provider", s.provider, "expiry", token.Expiry)
+	metrics.TokenRefreshes.Inc(s.provider)
+	if err := s.auth.Store.SetToken(s.provider, token); err != nil {
+		slog.Warn("Failed to persist refreshed token", "provider", s.provider, "error", err)
+	}
+	s.last = token.AccessToken
 	return token, nil
 }
+
+// missingTokenSource fails every request of a provider that was never
+// authorized.
+type missingTokenSource struct {
+	provider string
+}
+
+func (s missingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, fmt.Errorf("%w: no saved token for %s", ErrAuthRequired, s.provider)
+}
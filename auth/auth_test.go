@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRevokedAccess(t *testing.T) {
+	t.Chdir(t.TempDir())
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	store, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	if err := store.SetToken("strava", token); err != nil {
+		t.Fatal(err)
+	}
+	a := &Authenticator{Store: store}
+	client := a.GetClient(context.Background(), "strava", &oauth2.Config{})
+	if _, err := client.Get(srv.URL); err != nil || requests != 1 {
+		t.Fatalf("before revoking: %v, %d requests", err, requests)
+	}
+
+	// Another process, e.g. serve, hears that access was revoked.
+	other, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Revoke("strava"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrAuthRequired) {
+		t.Errorf("request after revoking = %v, want ErrAuthRequired", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests reached the server after revoking", requests-1)
+	}
+	if status := a.Status("strava"); status.Valid || status.Error == "" {
+		t.Errorf("Status = %+v, want invalid with the revocation", status)
+	}
+
+	// Saving another provider's token keeps the revocation.
+	if err := store.SetToken("fitbit", token); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.RevokedAt("strava"); !ok {
+		t.Error("saving the fitbit token dropped the strava revocation")
+	}
+
+	// Authorizing again ends it.
+	if err := store.SetToken("strava", token); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status("strava"); !status.Valid {
+		t.Errorf("Status after authorizing again = %+v", status)
+	}
+	if _, err := client.Get(srv.URL); err != nil {
+		t.Errorf("request after authorizing again: %v", err)
+	}
+}
+
+func TestProcessesKeepEachOthersTokens(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	first, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.SetToken("fitbit", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.SetToken("strava", old); err != nil {
+		t.Fatal(err)
+	}
+
+	// serve hears Strava access was revoked, `auth strava` runs in another
+	// process, then serve refreshes its Fitbit token.
+	serve, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Revoke("strava"); err != nil {
+		t.Fatal(err)
+	}
+	authorize, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strava := &oauth2.Token{AccessToken: "strava", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	if err := authorize.SetToken("strava", strava); err != nil {
+		t.Fatal(err)
+	}
+	fitbit := &oauth2.Token{AccessToken: "fitbit", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	if err := serve.SetToken("fitbit", fitbit); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.GetToken("strava"); got == nil || got.AccessToken != "strava" {
+		t.Errorf("saved strava token = %+v, want the new one", got)
+	}
+	if got := saved.GetToken("fitbit"); got == nil || got.AccessToken != "fitbit" {
+		t.Errorf("saved fitbit token = %+v, want the refreshed one", got)
+	}
+	if _, ok := saved.Revoked["strava"]; ok {
+		t.Error("the strava revocation came back")
+	}
+	if _, ok := serve.RevokedAt("strava"); ok {
+		t.Error("serve still sees strava as revoked")
+	}
+
+	// Processes saving at once all keep their tokens.
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			store, err := LoadTokens()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := store.SetToken(fmt.Sprintf("provider%d", i), old); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if saved, err = LoadTokens(); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Tokens) != 12 {
+		t.Errorf("saved %d tokens, want 12", len(saved.Tokens))
+	}
+}
+
+func TestRevokedAtRereadsOnlyChanges(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke("strava"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.RevokedAt("strava"); !ok {
+		t.Fatal("strava not revoked")
+	}
+
+	// An unchanged file isn't read again...
+	info, err := os.Stat(CredentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(CredentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := bytes.Replace(data, []byte(`"strava"`), []byte(`"fitbit"`), 1)
+	if err := os.WriteFile(CredentialsFile, other, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(CredentialsFile, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.RevokedAt("strava"); !ok {
+		t.Error("RevokedAt read an unchanged file again")
+	}
+
+	// ...but a changed one is.
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(CredentialsFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.RevokedAt("strava"); ok {
+		t.Error("RevokedAt missed the change")
+	}
+	if _, ok := store.RevokedAt("fitbit"); !ok {
+		t.Error("RevokedAt missed the fitbit revocation")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// The token endpoint rejects every refresh.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer srv.Close()
+
+	store, err := LoadTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Authenticator{Store: store}
+	if status := a.Status("fitbit"); status.Valid || status.Error != "not authorized" {
+		t.Errorf("Status without a token = %+v", status)
+	}
+
+	expired := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(-time.Hour)}
+	if err := store.SetToken("fitbit", expired); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status("fitbit"); status.Valid || status.Error != "expired" {
+		t.Errorf("Status of an expired token = %+v", status)
+	}
+
+	// An expired token that can be refreshed is fine until a refresh fails.
+	expired.RefreshToken = "refresh"
+	if err := store.SetToken("fitbit", expired); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status("fitbit"); !status.Valid || !status.Expiry.Equal(expired.Expiry) {
+		t.Errorf("Status of a refreshable token = %+v", status)
+	}
+	client := a.GetClient(context.Background(), "fitbit", &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}})
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrAuthRequired) {
+		t.Errorf("request with a rejected refresh = %v, want ErrAuthRequired", err)
+	}
+	if status := a.Status("fitbit"); status.Valid || status.Error == "" {
+		t.Errorf("Status after a rejected refresh = %+v", status)
+	}
+}
@@ -2,17 +2,33 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
 const CredentialsFile = "credentials.json"
 
+// lockFileName is locked while a process changes credentials.json, so that
+// processes sharing it, such as serve and daemon, don't overwrite each
+// other's tokens.
+const lockFileName = CredentialsFile + ".lock"
+
 type TokenStore struct {
 	mu     sync.Mutex
 	Tokens map[string]*oauth2.Token `json:"tokens"`
+	// Revoked holds when each provider's access was revoked by the user,
+	// until it is authorized again.
+	Revoked map[string]time.Time `json:"revoked,omitempty"`
+
+	// seen is the credentials.json RevokedAt last read, and seenRevoked
+	// the revocations in it.
+	seen        os.FileInfo
+	seenRevoked map[string]time.Time
 }
 
 // LoadTokens reads tokens from credentials.json
@@ -32,21 +48,97 @@ func LoadTokens() (*TokenStore, error) {
 	if err := json.Unmarshal(file, store); err != nil {
 		return nil, err
 	}
+	if store.Tokens == nil {
+		store.Tokens = make(map[string]*oauth2.Token)
+	}
 
 	return store, nil
 }
 
-// SaveTokens writes tokens to credentials.json
+// SaveTokens writes tokens to credentials.json, replacing what other
+// processes saved since they were loaded. SetToken, DeleteToken and Revoke
+// keep those changes.
 func (s *TokenStore) SaveTokens() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.write()
+}
+
+// change rereads credentials.json, applies change to it and saves it, all
+// while holding the lock on credentials.json.lock, so that only what change
+// does replaces what other processes saved. The store then holds the saved
+// tokens.
+func (s *TokenStore) change(change func(saved *TokenStore)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	saved, err := LoadTokens()
+	if err != nil {
+		return err
+	}
+	change(saved)
+	if err := saved.write(); err != nil {
+		return err
+	}
+	s.Tokens, s.Revoked = saved.Tokens, saved.Revoked
+	return nil
+}
+
+// write saves the tokens to a temporary file and renames it over
+// credentials.json, so that a crash can't leave it half-written. The lock
+// on credentials.json.lock must be held.
+func (s *TokenStore) write() error {
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(CredentialsFile, data, 0600)
+	f, err := os.CreateTemp(filepath.Dir(CredentialsFile), CredentialsFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), CredentialsFile)
+}
+
+// lock takes the lock on credentials.json.lock, waiting for other processes
+// to release it, and returns a function that releases it.
+func lock() (func(), error) {
+	f, err := os.OpenFile(lockFileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials lock: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock credentials: %v", err)
+	}
+	return func() { f.Close() }, nil
 }
 
 // GetToken retrieves a token by provider name (e.g., "fitbit", "strava")
@@ -56,11 +148,56 @@ func (s *TokenStore) GetToken(provider string) *oauth2.Token {
 	return s.Tokens[provider]
 }
 
-// SetToken saves a token for a provider
+// SetToken saves a token for a provider. A new token ends a revocation.
+// Other providers' tokens and revocations are kept as saved, e.g. a Strava
+// revocation serve recorded while daemon refreshed the Fitbit token.
 func (s *TokenStore) SetToken(provider string, token *oauth2.Token) error {
+	return s.change(func(saved *TokenStore) {
+		saved.Tokens[provider] = token
+		delete(saved.Revoked, provider)
+	})
+}
+
+// DeleteToken removes a provider's token, so the next use re-authorizes.
+func (s *TokenStore) DeleteToken(provider string) error {
+	return s.change(func(saved *TokenStore) {
+		delete(saved.Tokens, provider)
+	})
+}
+
+// Revoke deletes a provider's token and records that the user revoked
+// access, so requests fail with ErrAuthRequired until it is authorized
+// again.
+func (s *TokenStore) Revoke(provider string) error {
+	return s.change(func(saved *TokenStore) {
+		delete(saved.Tokens, provider)
+		if saved.Revoked == nil {
+			saved.Revoked = make(map[string]time.Time)
+		}
+		saved.Revoked[provider] = time.Now()
+	})
+}
+
+// RevokedAt reports whether provider's access was revoked, and when.
+// credentials.json is read again whenever it changed, so a revocation
+// recorded by another process, such as serve, is seen; if it can't be
+// read, the store's own state is used.
+func (s *TokenStore) RevokedAt(provider string) (time.Time, bool) {
 	s.mu.Lock()
-	s.Tokens[provider] = token
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	return s.SaveTokens()
+	info, err := os.Stat(CredentialsFile)
+	if err == nil && s.seen != nil && info.ModTime().Equal(s.seen.ModTime()) && info.Size() == s.seen.Size() {
+		at, ok := s.seenRevoked[provider]
+		return at, ok
+	}
+	if err == nil {
+		if saved, err := LoadTokens(); err == nil {
+			s.seen, s.seenRevoked = info, saved.Revoked
+			at, ok := saved.Revoked[provider]
+			return at, ok
+		}
+	}
+	at, ok := s.Revoked[provider]
+	return at, ok
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"fitbit-strava/auth"
+	"fitbit-strava/config"
+	"fitbit-strava/destination"
+	"fitbit-strava/ledger"
+)
+
+// runConfig implements `fitbit-strava config`: print the configuration as
+// loaded from .env and the environment, with secrets hidden, and check the
+// path templates.
+func runConfig(args []string) int {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	output := outputFlag(fs, "a JSON object of the settings, files and errors")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava config [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return reportError(err)
+	}
+
+	var rows [][2]string
+	row := func(name, value string) {
+		rows = append(rows, [2]string{name, value})
+	}
+	row("DESTINATIONS", strings.Join(cfg.Destinations, ","))
+	row("FITBIT_CLIENT_ID", cfg.FitbitClientID)
+	row("FITBIT_CLIENT_SECRET", secret(cfg.FitbitClientSecret))
+	row("FITBIT_SUBSCRIBER_ID", cfg.FitbitSubscriberID)
+	row("FITBIT_SUBSCRIBER_VERIFICATION_CODE", secret(cfg.FitbitVerificationCode))
+	row("STRAVA_CLIENT_ID", cfg.StravaClientID)
+	row("STRAVA_CLIENT_SECRET", secret(cfg.StravaClientSecret))
+	row("STRAVA_WEBHOOK_VERIFY_TOKEN", secret(cfg.StravaVerifyToken))
+	row("ARCHIVE_DIR", cfg.ArchiveDir)
+	row("INTERVALS_ATHLETE_ID", cfg.IntervalsAthleteID)
+	row("INTERVALS_API_KEY", secret(cfg.IntervalsAPIKey))
+	row("WEBDAV_URL", cfg.WebDAVURL)
+	row("WEBDAV_USERNAME", cfg.WebDAVUsername)
+	row("WEBDAV_PASSWORD", secret(cfg.WebDAVPassword))
+	row("WEBDAV_PATH_TEMPLATE", cfg.WebDAVPathTemplate)
+	row("S3_ENDPOINT", cfg.S3Endpoint)
+	row("S3_REGION", cfg.S3Region)
+	row("S3_BUCKET", cfg.S3Bucket)
+	row("S3_ACCESS_KEY_ID", cfg.S3AccessKey)
+	row("S3_SECRET_ACCESS_KEY", secret(cfg.S3SecretKey))
+	row("S3_KEY_TEMPLATE", cfg.S3KeyTemplate)
+	row("NOTIFY_ON", cfg.NotifyOn)
+	row("NOTIFY_WEBHOOK_URL", cfg.NotifyWebhookURL)
+	row("NOTIFY_NTFY_URL", cfg.NotifyNtfyURL)
+	row("NOTIFY_NTFY_TOKEN", secret(cfg.NotifyNtfyToken))
+	row("NOTIFY_SMTP_ADDR", cfg.NotifySMTPAddr)
+	row("NOTIFY_SMTP_USERNAME", cfg.NotifySMTPUsername)
+	row("NOTIFY_SMTP_PASSWORD", secret(cfg.NotifySMTPPassword))
+	row("NOTIFY_EMAIL_FROM", cfg.NotifyEmailFrom)
+	row("NOTIFY_EMAIL_TO", strings.Join(cfg.NotifyEmailTo, ","))
+	row("NOTIFY_EXEC", cfg.NotifyExec)
+	row("HOOK_SELECTED", cfg.HookSelected)
+	row("HOOK_ENCODED", cfg.HookEncoded)
+	row("HOOK_BEFORE_UPLOAD", cfg.HookBeforeUpload)
+	row("HOOK_UPLOADED", cfg.HookUploaded)
+	row("FIT_MANUFACTURER", cfg.DeviceManufacturer)
+	row("FIT_PRODUCT", cfg.DeviceProduct)
+	row("FIT_SERIAL_NUMBER", cfg.DeviceSerial)
+	row("FIT_SOFTWARE_VERSION", cfg.DeviceSoftware)
+
+	var problems []string
+	for _, t := range []struct{ name, text string }{
+		{"WEBDAV_PATH_TEMPLATE", cfg.WebDAVPathTemplate},
+		{"S3_KEY_TEMPLATE", cfg.S3KeyTemplate},
+	} {
+		if _, err := destination.ParsePathTemplate(t.text); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", t.name, err))
+		}
+	}
+
+	if *output == "json" {
+		type configFile struct {
+			Path   string `json:"path"`
+			Exists bool   `json:"exists"`
+		}
+		report := struct {
+			Settings map[string]string     `json:"settings"`
+			Files    map[string]configFile `json:"files"`
+			Errors   []string              `json:"errors,omitempty"`
+		}{
+			Settings: make(map[string]string, len(rows)),
+			Files: map[string]configFile{
+				"tokens": {auth.CredentialsFile, fileState(auth.CredentialsFile) == ""},
+				"ledger": {ledger.LedgerFile, fileState(ledger.LedgerFile) == ""},
+			},
+			Errors: problems,
+		}
+		for _, r := range rows {
+			report.Settings[r[0]] = r[1]
+		}
+		if err := printJSON(report); err != nil {
+			return reportError(err)
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, r := range rows {
+			value := r[1]
+			if value == "" {
+				value = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", r[0], value)
+		}
+		fmt.Fprintf(tw, "Tokens\t%s%s\n", auth.CredentialsFile, fileState(auth.CredentialsFile))
+		fmt.Fprintf(tw, "Ledger\t%s%s\n", ledger.LedgerFile, fileState(ledger.LedgerFile))
+		tw.Flush()
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// secret shows whether a secret is set without revealing it.
+func secret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "(set)"
+}
+
+func fileState(name string) string {
+	if _, err := os.Stat(name); err != nil {
+		return " (missing)"
+	}
+	return ""
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -10,32 +12,164 @@ import (
 type Config struct {
 	FitbitClientID     string
 	FitbitClientSecret string
+	// FitbitSubscriberID and FitbitVerificationCode identify the subscriber
+	// endpoint `fitbit-strava serve` runs, as registered at dev.fitbit.com.
+	FitbitSubscriberID     string
+	FitbitVerificationCode string
 
 	StravaClientID     string
 	StravaClientSecret string
+	// StravaVerifyToken is the secret Strava echoes back when validating
+	// the push subscription callback of `fitbit-strava serve`.
+	StravaVerifyToken string
+
+	// Destinations lists where activities go: any of "strava",
+	// "intervals", "archive", "webdav" and "s3".
+	Destinations []string
+	ArchiveDir   string
+
+	IntervalsAthleteID string
+	IntervalsAPIKey    string
+
+	WebDAVURL          string
+	WebDAVUsername     string
+	WebDAVPassword     string
+	WebDAVPathTemplate string
+
+	S3Endpoint    string
+	S3Region      string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3KeyTemplate string
+
+	// Notifiers, each used if set. NotifyOn is "all" or "failure".
+	NotifyOn           string
+	NotifyWebhookURL   string
+	NotifyNtfyURL      string
+	NotifyNtfyToken    string
+	NotifySMTPAddr     string
+	NotifySMTPUsername string
+	NotifySMTPPassword string
+	NotifyEmailFrom    string
+	NotifyEmailTo      []string
+	NotifyExec         string
+
+	// Programs run at the pipeline's hook points; empty for none.
+	HookSelected     string
+	HookEncoded      string
+	HookBeforeUpload string
+	HookUploaded     string
+
+	// Optional overrides for the device written to FIT files.
+	DeviceManufacturer string
+	DeviceProduct      string
+	DeviceSerial       string
+	DeviceSoftware     string
 }
 
 func Load() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
 		// .env is optional if env vars are set otherwise, but for this CLI it's expected
-		fmt.Println("Warning: Error loading .env file")
+		slog.Warn("Failed to load .env file", "error", err)
 	}
 
 	cfg := &Config{
 		FitbitClientID:     os.Getenv("FITBIT_CLIENT_ID"),
 		FitbitClientSecret: os.Getenv("FITBIT_CLIENT_SECRET"),
 
+		FitbitSubscriberID:     os.Getenv("FITBIT_SUBSCRIBER_ID"),
+		FitbitVerificationCode: os.Getenv("FITBIT_SUBSCRIBER_VERIFICATION_CODE"),
+
 		StravaClientID:     os.Getenv("STRAVA_CLIENT_ID"),
 		StravaClientSecret: os.Getenv("STRAVA_CLIENT_SECRET"),
+		StravaVerifyToken:  os.Getenv("STRAVA_WEBHOOK_VERIFY_TOKEN"),
+
+		DeviceManufacturer: os.Getenv("FIT_MANUFACTURER"),
+		DeviceProduct:      os.Getenv("FIT_PRODUCT"),
+		DeviceSerial:       os.Getenv("FIT_SERIAL_NUMBER"),
+		DeviceSoftware:     os.Getenv("FIT_SOFTWARE_VERSION"),
 	}
 
 	if cfg.FitbitClientID == "" || cfg.FitbitClientSecret == "" {
 		return nil, fmt.Errorf("missing Fitbit credentials in .env")
 	}
-	if cfg.StravaClientID == "" || cfg.StravaClientSecret == "" {
+	cfg.Destinations = []string{"strava"}
+	if v := os.Getenv("DESTINATIONS"); v != "" {
+		cfg.Destinations = nil
+		for _, d := range strings.Split(v, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				cfg.Destinations = append(cfg.Destinations, d)
+			}
+		}
+	}
+	cfg.IntervalsAthleteID = os.Getenv("INTERVALS_ATHLETE_ID")
+	cfg.IntervalsAPIKey = os.Getenv("INTERVALS_API_KEY")
+	cfg.WebDAVURL = os.Getenv("WEBDAV_URL")
+	cfg.WebDAVUsername = os.Getenv("WEBDAV_USERNAME")
+	cfg.WebDAVPassword = os.Getenv("WEBDAV_PASSWORD")
+	cfg.WebDAVPathTemplate = os.Getenv("WEBDAV_PATH_TEMPLATE")
+	cfg.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.S3Region = os.Getenv("S3_REGION")
+	cfg.S3Bucket = os.Getenv("S3_BUCKET")
+	cfg.S3AccessKey = os.Getenv("S3_ACCESS_KEY_ID")
+	cfg.S3SecretKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+	cfg.S3KeyTemplate = os.Getenv("S3_KEY_TEMPLATE")
+	cfg.NotifyOn = strings.ToLower(os.Getenv("NOTIFY_ON"))
+	if cfg.NotifyOn == "" {
+		cfg.NotifyOn = "all"
+	}
+	cfg.NotifyWebhookURL = os.Getenv("NOTIFY_WEBHOOK_URL")
+	cfg.NotifyNtfyURL = os.Getenv("NOTIFY_NTFY_URL")
+	cfg.NotifyNtfyToken = os.Getenv("NOTIFY_NTFY_TOKEN")
+	cfg.NotifySMTPAddr = os.Getenv("NOTIFY_SMTP_ADDR")
+	cfg.NotifySMTPUsername = os.Getenv("NOTIFY_SMTP_USERNAME")
+	cfg.NotifySMTPPassword = os.Getenv("NOTIFY_SMTP_PASSWORD")
+	cfg.NotifyEmailFrom = os.Getenv("NOTIFY_EMAIL_FROM")
+	for _, to := range strings.Split(os.Getenv("NOTIFY_EMAIL_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			cfg.NotifyEmailTo = append(cfg.NotifyEmailTo, to)
+		}
+	}
+	cfg.NotifyExec = os.Getenv("NOTIFY_EXEC")
+	cfg.HookSelected = os.Getenv("HOOK_SELECTED")
+	cfg.HookEncoded = os.Getenv("HOOK_ENCODED")
+	cfg.HookBeforeUpload = os.Getenv("HOOK_BEFORE_UPLOAD")
+	cfg.HookUploaded = os.Getenv("HOOK_UPLOADED")
+	cfg.ArchiveDir = os.Getenv("ARCHIVE_DIR")
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = "activities"
+	}
+
+	if cfg.HasDestination("strava") && (cfg.StravaClientID == "" || cfg.StravaClientSecret == "") {
 		return nil, fmt.Errorf("missing Strava credentials in .env")
 	}
+	if cfg.HasDestination("intervals") && cfg.IntervalsAPIKey == "" {
+		return nil, fmt.Errorf("missing INTERVALS_API_KEY in .env")
+	}
+	if cfg.HasDestination("webdav") && cfg.WebDAVURL == "" {
+		return nil, fmt.Errorf("missing WEBDAV_URL in .env")
+	}
+	if cfg.HasDestination("s3") && (cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "") {
+		return nil, fmt.Errorf("missing S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID or S3_SECRET_ACCESS_KEY in .env")
+	}
+	if cfg.NotifyOn != "all" && cfg.NotifyOn != "failure" {
+		return nil, fmt.Errorf("invalid NOTIFY_ON %q in .env (want all or failure)", cfg.NotifyOn)
+	}
+	if cfg.NotifySMTPAddr != "" && (cfg.NotifyEmailFrom == "" || len(cfg.NotifyEmailTo) == 0) {
+		return nil, fmt.Errorf("missing NOTIFY_EMAIL_FROM or NOTIFY_EMAIL_TO in .env")
+	}
 
 	return cfg, nil
 }
+
+// HasDestination reports whether activities are sent to the named destination.
+func (c *Config) HasDestination(name string) bool {
+	for _, d := range c.Destinations {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/metrics"
+	"fitbit-strava/pipeline"
+)
+
+const (
+	// minRetryDelay is the wait after a first failed check; it doubles with
+	// each consecutive failure up to maxRetryDelay.
+	minRetryDelay = time.Minute
+	maxRetryDelay = time.Hour
+	// rateLimitDelay is the least to wait after hitting a rate limit. Strava's
+	// short-term limit is per 15 minutes; Fitbit's is per hour.
+	rateLimitDelay = 15 * time.Minute
+)
+
+// runDaemon implements `fitbit-strava daemon`: check for new activities
+// every -interval and sync them, until SIGINT or SIGTERM.
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	interval := fs.Duration("interval", 15*time.Minute, "Time between checks for new activities")
+	days := fs.Int("days", 2, "Only sync activities that started in the last this many days")
+	limit := fs.Int("limit", 20, "Look at this many of the most recent activities")
+	metricsAddr := fs.String("metrics-addr", "", "Serve /metrics and /healthz on this address, e.g. :9090")
+	encode := newEncodeFlags(fs)
+	gps := newGPSFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava daemon [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *interval < time.Minute {
+		fmt.Fprintln(os.Stderr, "Error: -interval must be at least 1m")
+		return exitUsage
+	}
+
+	opts, err := encode.options()
+	if err != nil {
+		return reportError(err)
+	}
+
+	cfg, authenticator := loadAuth()
+	p := newPipeline(cfg, authenticator)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *metricsAddr != "" {
+		serveObservability(ctx, *metricsAddr, cfg, authenticator)
+	}
+
+	slog.Info("Daemon started", "interval", *interval, "destinations", destination.Names(p.Destinations))
+	failures := 0
+	seen := make(discoveries)
+	for {
+		wait := *interval
+		results, err := syncPending(ctx, p, seen, *limit, *days, opts, gps)
+		observeRun(p, "daemon", results, err)
+		if err != nil {
+			if exitCodeFor(err) == exitAuth {
+				slog.Error("Authorization required; run `fitbit-strava auth`", "error", err)
+				return exitAuth
+			}
+			failures++
+			wait = retryDelay(failures, err)
+			slog.Warn("Sync failed", "error", err, "retry_in", wait)
+		} else {
+			failures = 0
+			metrics.LastSuccess.Set(float64(time.Now().Unix()))
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Daemon stopped")
+			return exitOK
+		case <-time.After(wait):
+		}
+	}
+}
+
+// syncPending uploads the activities that aren't synced yet, oldest first.
+// Activities whose device hasn't synced since they ended are left for a
+// later check, as are ones that fail; skipped ones are recorded so they
+// aren't. seen holds the activities earlier checks picked up. It returns an error if the activities couldn't be
+// listed, or a rate limit or authorization problem cut the run short.
+// Shutdown stops it between activities. It returns the results of the
+// activities it tried either way.
+func syncPending(ctx context.Context, p *pipeline.Pipeline, seen discoveries, limit, days int, opts pipeline.Options, gps gpsFlags) ([]activityResult, error) {
+	if err := reloadLedger(p); err != nil {
+		return nil, err
+	}
+
+	pending, err := p.Pending(limit, days, *gps.include)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent activities: %w", err)
+	}
+	if len(pending) == 0 {
+		slog.Debug("Nothing to sync")
+		return nil, nil
+	}
+	devices, err := p.Fitbit.GetDevices()
+	if err != nil {
+		slog.Warn("Failed to fetch devices; not waiting for device syncs", "error", err)
+	}
+
+	var results []activityResult
+	for i := len(pending) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return results, nil
+		}
+		act := pending[i]
+		if devices != nil && pipeline.WaitingForDevice(act, devices) {
+			slog.Info("Waiting for the device to sync", "name", act.Name, "log_id", act.LogID)
+			continue
+		}
+		seen.add(act)
+		res := syncActivity(p, act, opts, gps)
+		recordSkip(p, act, res, devices)
+		observeActivity(p, "daemon", res)
+		results = append(results, res)
+		if code := exitCodeFor(res.err); code == exitAuth || code == exitRateLimited {
+			return results, res.err
+		}
+	}
+	return results, nil
+}
+
+// recordSkip notes a skipped activity in the ledger, so later checks don't
+// fetch it again and notify about it every time. Missing heart rate only
+// counts once the device has synced since the activity ended; until then
+// it may yet arrive.
+func recordSkip(p *pipeline.Pipeline, act fitbit.ActivityLog, res activityResult, devices []fitbit.Device) {
+	switch {
+	case errors.Is(res.err, pipeline.ErrSkipped):
+	case errors.Is(res.err, pipeline.ErrNoHeartRate) && devices != nil && !pipeline.WaitingForDevice(act, devices):
+	default:
+		return
+	}
+	if err := p.Skip(act, res.err); err != nil {
+		slog.Warn("Failed to record skipped activity", "name", act.Name, "log_id", act.LogID, "error", err)
+	}
+}
+
+// reloadLedger rereads the ledger, which sync or pick may have updated
+// since a long-running command loaded it.
+func reloadLedger(p *pipeline.Pipeline) error {
+	if err := p.Ledger.Reload(); err != nil {
+		return fmt.Errorf("failed to load sync ledger: %v", err)
+	}
+	return nil
+}
+
+// retryDelay is how long to wait after the given number of consecutive
+// failed checks.
+func retryDelay(failures int, err error) time.Duration {
+	delay := maxRetryDelay
+	if failures < 8 {
+		delay = min(minRetryDelay<<(failures-1), maxRetryDelay)
+	}
+	if exitCodeFor(err) == exitRateLimited {
+		delay = max(delay, rateLimitDelay)
+	}
+	return delay
+}
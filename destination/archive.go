@@ -0,0 +1,95 @@
+package destination
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Archive keeps copies of activity files in a local directory, named by
+// start time and sport (2026-10-16_1830_Spinning.fit), each with a JSON
+// sidecar of its metadata. Re-uploading an activity overwrites its files.
+type Archive struct {
+	Dir string
+}
+
+func NewArchive(dir string) *Archive {
+	return &Archive{Dir: dir}
+}
+
+// Sidecar is the JSON written next to each archived file.
+type Sidecar struct {
+	File        string    `json:"file"`
+	Format      string    `json:"format"`
+	Name        string    `json:"name"`
+	Sport       string    `json:"sport"`
+	StartTime   time.Time `json:"start_time"`
+	Description string    `json:"description,omitempty"`
+	ExternalID  string    `json:"external_id,omitempty"`
+	Size        int       `json:"size"`
+	ArchivedAt  time.Time `json:"archived_at"`
+}
+
+func (a *Archive) Name() string { return "archive" }
+
+func (a *Archive) Upload(act Activity) (Result, error) {
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return Result{}, fmt.Errorf("failed to create archive directory: %v", err)
+	}
+
+	base := ArchiveName(act)
+	file := filepath.Join(a.Dir, base+"."+act.Format)
+	if err := os.WriteFile(file, act.Data, 0644); err != nil {
+		return Result{}, fmt.Errorf("failed to write activity file: %v", err)
+	}
+
+	sidecar, err := json.MarshalIndent(Sidecar{
+		File:        filepath.Base(file),
+		Format:      act.Format,
+		Name:        act.Name,
+		Sport:       act.Sport,
+		StartTime:   act.StartTime,
+		Description: act.Description,
+		ExternalID:  act.ExternalID,
+		Size:        len(act.Data),
+		ArchivedAt:  time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode sidecar: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(a.Dir, base+".json"), append(sidecar, '\n'), 0644); err != nil {
+		return Result{}, fmt.Errorf("failed to write sidecar: %v", err)
+	}
+
+	return Result{ID: file, Detail: "saved to " + file}, nil
+}
+
+// ArchiveName returns the file name, without extension, for an activity.
+func ArchiveName(act Activity) string {
+	name := act.StartTime.Local().Format("2006-01-02_1504")
+	if sport := sanitize(act.Sport); sport != "" {
+		name += "_" + sport
+	}
+	return name
+}
+
+// sanitize keeps letters and digits and turns runs of anything else into a
+// single dash, so names are safe on every filesystem.
+func sanitize(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,106 @@
+// Package destination delivers finished activity files: to Strava or
+// intervals.icu, to a local archive directory, or to WebDAV or S3-compatible
+// storage.
+package destination
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Activity is an encoded activity file and what is known about it.
+type Activity struct {
+	Data   []byte
+	Format string // file extension: fit, tcx or gpx
+
+	Name        string // display name, e.g. "Evening workout 🌙"
+	Sport       string // activity type, e.g. "Spinning"
+	StartTime   time.Time
+	Description string
+	// ExternalID identifies the source activity, e.g. "fitbit-1234".
+	ExternalID string
+}
+
+// Result describes where an activity ended up.
+type Result struct {
+	// ID is the destination's identifier: an activity id, a file path.
+	ID string
+	// UploadID is set by destinations that process uploads asynchronously.
+	// ID may be empty if processing hadn't finished.
+	UploadID string
+	// URL links to the activity or file, if it has one.
+	URL string
+	// Detail is a human-readable response, for logging.
+	Detail string
+}
+
+// Destination receives activity files.
+type Destination interface {
+	// Name identifies the destination in config and output, e.g. "strava".
+	Name() string
+	Upload(a Activity) (Result, error)
+}
+
+// Outcome is the result of uploading to one destination.
+type Outcome struct {
+	Destination string
+	Result      Result
+	Err         error
+}
+
+// UploadAll uploads a to every destination, continuing past failures.
+func UploadAll(dests []Destination, a Activity) []Outcome {
+	outcomes := make([]Outcome, 0, len(dests))
+	for _, d := range dests {
+		res, err := d.Upload(a)
+		outcomes = append(outcomes, Outcome{Destination: d.Name(), Result: res, Err: err})
+	}
+	return outcomes
+}
+
+// Names returns the destinations' names joined for display.
+func Names(dests []Destination) string {
+	names := make([]string, len(dests))
+	for i, d := range dests {
+		names[i] = d.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// UploadError is the failure of one or more destinations. It unwraps to
+// their errors.
+type UploadError struct {
+	Failed []Outcome
+}
+
+func (e *UploadError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, o := range e.Failed {
+		msgs[i] = fmt.Sprintf("%s: %v", o.Destination, o.Err)
+	}
+	return "upload failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *UploadError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, o := range e.Failed {
+		errs[i] = o.Err
+	}
+	return errs
+}
+
+// Failed returns the outcomes' errors as an *UploadError, or nil if all
+// succeeded.
+func Failed(outcomes []Outcome) error {
+	var failed []Outcome
+	for _, o := range outcomes {
+		if o.Err != nil {
+			failed = append(failed, o)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &UploadError{Failed: failed}
+}
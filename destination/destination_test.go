@@ -0,0 +1,128 @@
+package destination
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func spinning() Activity {
+	return Activity{
+		Data:       []byte("fit data"),
+		Format:     "fit",
+		Name:       "Evening workout",
+		Sport:      "Spinning / Indoor",
+		StartTime:  time.Date(2026, 10, 16, 18, 30, 0, 0, time.Local),
+		ExternalID: "fitbit-1234",
+	}
+}
+
+func TestArchiveUpload(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "archive")
+	a := NewArchive(dir)
+
+	res, err := a.Upload(spinning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "2026-10-16_1830_Spinning-Indoor.fit")
+	if res.ID != want {
+		t.Errorf("archived to %s, want %s", res.ID, want)
+	}
+	if data, err := os.ReadFile(want); err != nil || string(data) != "fit data" {
+		t.Errorf("archived file = %q, %v", data, err)
+	}
+
+	// Uploading again overwrites both files.
+	act := spinning()
+	act.Data = []byte("new fit data")
+	if _, err := a.Upload(act); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "2026-10-16_1830_Spinning-Indoor.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sidecar Sidecar
+	if err := json.Unmarshal(raw, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.File != filepath.Base(want) || sidecar.Size != len("new fit data") || sidecar.ExternalID != "fitbit-1234" {
+		t.Errorf("sidecar = %+v", sidecar)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("archive has %d files, want the activity and its sidecar", len(entries))
+	}
+}
+
+func TestRenderPath(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", "2026/2026-10-16_1830_Spinning-Indoor.fit"},
+		{`/{{.StartTime.Format "2006/01"}}/../{{.ExternalID}}.{{.Format}} `, "2026/fitbit-1234.fit"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParsePathTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := renderPath(tmpl, spinning()); err != nil || got != tt.want {
+			t.Errorf("renderPath(%q) = %q, %v; want %q", tt.template, got, err, tt.want)
+		}
+	}
+
+	tmpl, _ := ParsePathTemplate("{{.Description}}")
+	if _, err := renderPath(tmpl, spinning()); err == nil {
+		t.Error("rendered an empty path")
+	}
+}
+
+// stub is a destination that fails with err, if set.
+type stub struct {
+	name    string
+	err     error
+	uploads int
+}
+
+func (s *stub) Name() string { return s.name }
+
+func (s *stub) Upload(Activity) (Result, error) {
+	s.uploads++
+	if s.err != nil {
+		return Result{}, s.err
+	}
+	return Result{ID: s.name + "-1"}, nil
+}
+
+func TestUploadAllContinuesPastFailures(t *testing.T) {
+	errDown := errors.New("service unavailable")
+	strava, webdav, archive := &stub{name: "strava"}, &stub{name: "webdav", err: errDown}, &stub{name: "archive"}
+	dests := []Destination{strava, webdav, archive}
+
+	outcomes := UploadAll(dests, spinning())
+	var names []string
+	for _, o := range outcomes {
+		names = append(names, o.Destination)
+	}
+	if !reflect.DeepEqual(names, []string{"strava", "webdav", "archive"}) || archive.uploads != 1 {
+		t.Errorf("outcomes for %v, archive uploaded %d times", names, archive.uploads)
+	}
+
+	err := Failed(outcomes)
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || len(uploadErr.Failed) != 1 || !errors.Is(err, errDown) {
+		t.Fatalf("Failed = %v, want webdav's error", err)
+	}
+	if got := err.Error(); got != "upload failed: webdav: service unavailable" {
+		t.Errorf("error = %q", got)
+	}
+	if err := Failed(UploadAll([]Destination{strava, archive}, spinning())); err != nil {
+		t.Errorf("Failed = %v, want nil", err)
+	}
+}
@@ -0,0 +1,32 @@
+package destination
+
+import (
+	"bytes"
+
+	"fitbit-strava/intervals"
+)
+
+// Intervals uploads to intervals.icu.
+type Intervals struct {
+	Client *intervals.Client
+}
+
+func NewIntervals(client *intervals.Client) *Intervals {
+	return &Intervals{Client: client}
+}
+
+func (i *Intervals) Name() string { return "intervals" }
+
+func (i *Intervals) Upload(a Activity) (Result, error) {
+	metadata := intervals.ActivityMetadata{
+		Name:        a.Name,
+		Description: a.Description,
+		ExternalID:  a.ExternalID,
+	}
+	created, err := i.Client.Upload(bytes.NewReader(a.Data), "workout."+a.Format, metadata)
+	if err != nil {
+		return Result{}, err
+	}
+	url := "https://intervals.icu/activities/" + created.ID
+	return Result{ID: created.ID, URL: url, Detail: url}, nil
+}
@@ -0,0 +1,65 @@
+package destination
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// DefaultPathTemplate files activities by year, using the archive naming:
+// 2026/2026-10-16_1830_Spinning.fit.
+const DefaultPathTemplate = `{{.StartTime.Format "2006"}}/{{.Base}}.{{.Format}}`
+
+// PathData is what a path template is executed with: the activity, with
+// StartTime in local time, plus Base, the archive file name without
+// extension.
+type PathData struct {
+	Activity
+	Base string
+}
+
+// ParsePathTemplate parses a text/template for remote file paths, e.g.
+// {{.StartTime.Format "2006/01"}}/{{.ExternalID}}.{{.Format}}. An empty
+// string means DefaultPathTemplate.
+func ParsePathTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultPathTemplate
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderPath executes tmpl for act and cleans the result into a relative
+// slash-separated path.
+func renderPath(tmpl *template.Template, act Activity) (string, error) {
+	data := PathData{Activity: act, Base: ArchiveName(act)}
+	data.StartTime = act.StartTime.Local()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render path template: %v", err)
+	}
+	p := strings.TrimPrefix(path.Clean("/"+strings.TrimSpace(buf.String())), "/")
+	if p == "" {
+		return "", fmt.Errorf("path template rendered an empty path")
+	}
+	return p, nil
+}
+
+// contentType returns the MIME type for an activity file format.
+func contentType(format string) string {
+	switch format {
+	case "fit":
+		return "application/vnd.ant.fit"
+	case "tcx":
+		return "application/vnd.garmin.tcx+xml"
+	case "gpx":
+		return "application/gpx+xml"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,32 @@
+package destination
+
+import (
+	"text/template"
+
+	"fitbit-strava/s3"
+)
+
+// S3 stores activity files in an S3-compatible bucket such as MinIO, under
+// a key rendered from a template.
+type S3 struct {
+	Client *s3.Client
+	Key    *template.Template
+}
+
+func NewS3(client *s3.Client, key *template.Template) *S3 {
+	return &S3{Client: client, Key: key}
+}
+
+func (s *S3) Name() string { return "s3" }
+
+func (s *S3) Upload(a Activity) (Result, error) {
+	key, err := renderPath(s.Key, a)
+	if err != nil {
+		return Result{}, err
+	}
+	objectURL, err := s.Client.PutObject(key, a.Data, contentType(a.Format))
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{ID: objectURL, URL: objectURL, Detail: "saved to " + objectURL}, nil
+}
@@ -0,0 +1,56 @@
+package destination
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"fitbit-strava/strava"
+)
+
+// uploadTimeout is how long to wait for Strava to turn an upload into an
+// activity. It usually takes a few seconds.
+const uploadTimeout = 30 * time.Second
+
+// Strava uploads to Strava.
+type Strava struct {
+	Client *strava.Client
+}
+
+func NewStrava(client *strava.Client) *Strava {
+	return &Strava{Client: client}
+}
+
+func (s *Strava) Name() string { return "strava" }
+
+func (s *Strava) Upload(a Activity) (Result, error) {
+	metadata := strava.ActivityMetadata{
+		Name:        a.Name,
+		Description: a.Description,
+		ExternalID:  a.ExternalID,
+	}
+	status, err := s.Client.Upload(bytes.NewReader(a.Data), "workout."+a.Format, metadata)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// The activity is created asynchronously. A rejected file, such as a
+	// duplicate, is a failure; failing to poll is not, as the upload went
+	// through.
+	final, err := s.Client.WaitForUpload(status, uploadTimeout)
+	if final.Error != "" {
+		return Result{UploadID: final.IDStr}, err
+	}
+	if err != nil {
+		slog.Warn("Failed to check Strava upload", "upload_id", final.IDStr, "error", err)
+	}
+	res := Result{UploadID: final.IDStr, Detail: fmt.Sprintf("upload %s is still processing", final.IDStr)}
+	if final.ActivityID != 0 {
+		res.ID = strconv.FormatInt(final.ActivityID, 10)
+		res.URL = "https://www.strava.com/activities/" + res.ID
+		res.Detail = res.URL
+	}
+	return res, nil
+}
@@ -0,0 +1,32 @@
+package destination
+
+import (
+	"text/template"
+
+	"fitbit-strava/webdav"
+)
+
+// WebDAV stores activity files on a WebDAV server such as Nextcloud, at a
+// path rendered from a template.
+type WebDAV struct {
+	Client *webdav.Client
+	Path   *template.Template
+}
+
+func NewWebDAV(client *webdav.Client, path *template.Template) *WebDAV {
+	return &WebDAV{Client: client, Path: path}
+}
+
+func (w *WebDAV) Name() string { return "webdav" }
+
+func (w *WebDAV) Upload(a Activity) (Result, error) {
+	p, err := renderPath(w.Path, a)
+	if err != nil {
+		return Result{}, err
+	}
+	fileURL, err := w.Client.Put(p, a.Data, contentType(a.Format))
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{ID: fileURL, URL: fileURL, Detail: "saved to " + fileURL}, nil
+}
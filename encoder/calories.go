@@ -0,0 +1,102 @@
+package encoder
+
+import (
+	"math"
+	"time"
+)
+
+// Profile describes the athlete for HR-based calorie estimation.
+type Profile struct {
+	Age      int
+	WeightKg float64
+	Sex      string // "male", "female" or "" if unknown
+}
+
+// Longest gap between samples that still counts as active time.
+const maxCalorieGap = 10 * time.Second
+
+// keytelKcalPerMin estimates energy expenditure from heart rate using
+// Keytel et al. (2005). When the sex is unknown the two equations are
+// averaged.
+func keytelKcalPerMin(hr float64, p Profile) float64 {
+	age, weight := float64(p.Age), p.WeightKg
+	male := (-55.0969 + 0.6309*hr + 0.1988*weight + 0.2017*age) / 4.184
+	female := (-20.4022 + 0.4472*hr - 0.1263*weight + 0.074*age) / 4.184
+
+	var kcal float64
+	switch p.Sex {
+	case "male":
+		kcal = male
+	case "female":
+		kcal = female
+	default:
+		kcal = (male + female) / 2
+	}
+	return math.Max(kcal, 0)
+}
+
+// applyCalories sets the workout total and makes sure every sample carries
+// accumulated calories that add up to it.
+//
+// The total is the source's total when known; otherwise it is estimated
+// from heart rate and the profile, and failing that taken from the samples'
+// own accumulated calories. The shape of the curve comes from the samples'
+// calories when the source provided them (e.g. Fitbit's per-minute series),
+// otherwise from the HR-based estimate, otherwise from heart beats.
+func applyCalories(w *workout, total int, fromSource bool, profile *Profile) {
+	samples := w.samples
+	w.calories = total
+
+	weights := make([]float64, len(samples))
+	var estimate float64
+	var previous float64
+	for i, s := range samples {
+		dt := time.Second
+		if i+1 < len(samples) {
+			dt = min(samples[i+1].Time.Sub(s.Time), maxCalorieGap)
+		}
+		minutes := dt.Minutes()
+
+		if profile != nil {
+			estimate += keytelKcalPerMin(float64(s.HeartRate), *profile) * minutes
+		}
+
+		switch {
+		case fromSource:
+			weights[i] = s.Calories - previous
+			previous = s.Calories
+		case profile != nil:
+			weights[i] = keytelKcalPerMin(float64(s.HeartRate), *profile) * minutes
+		default:
+			weights[i] = float64(s.HeartRate) * minutes
+		}
+	}
+
+	target := float64(total)
+	switch {
+	case target > 0:
+		// The source total wins.
+	case profile != nil:
+		target = estimate
+	case fromSource:
+		target = samples[len(samples)-1].Calories
+	default:
+		return
+	}
+	w.calories = int(math.Round(target))
+
+	var sum float64
+	for _, wt := range weights {
+		sum += wt
+	}
+	if sum <= 0 {
+		return
+	}
+
+	var cumulative float64
+	for i := range samples {
+		cumulative += weights[i] / sum * target
+		samples[i].Calories = cumulative
+	}
+	w.hasCalories = true
+}
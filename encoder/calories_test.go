@@ -0,0 +1,76 @@
+package encoder
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestApplyCaloriesKeepsSourceShape(t *testing.T) {
+	// Fitbit's series burns twice as fast in the second half.
+	samples := secondSamples(0, 120, steadyHR)
+	var kcal float64
+	for i := range samples {
+		if i < 60 {
+			kcal += 0.1
+		} else {
+			kcal += 0.2
+		}
+		samples[i].Calories = kcal
+	}
+	w := &workout{samples: samples}
+	applyCalories(w, 90, true, nil)
+
+	if !w.hasCalories || w.calories != 90 {
+		t.Fatalf("calories %d (has %v), want the logged 90", w.calories, w.hasCalories)
+	}
+	if last := samples[len(samples)-1].Calories; math.Abs(last-90) > 1e-9 {
+		t.Errorf("records end at %v kcal, want 90", last)
+	}
+	if half := samples[59].Calories; math.Abs(half-30) > 1e-9 {
+		t.Errorf("first half burned %v kcal, want a third of 90", half)
+	}
+}
+
+func TestApplyCaloriesEstimatesFromHeartRate(t *testing.T) {
+	samples := secondSamples(0, 600, func(i int) uint8 {
+		if i < 300 {
+			return 100
+		}
+		return 160
+	})
+	profile := &Profile{Age: 40, WeightKg: 75, Sex: "male"}
+	w := &workout{samples: samples}
+	applyCalories(w, 0, false, profile)
+
+	want := 5*keytelKcalPerMin(100, *profile) + 5*keytelKcalPerMin(160, *profile)
+	if w.calories != int(math.Round(want)) {
+		t.Errorf("estimated %d kcal, want %.0f", w.calories, want)
+	}
+	easy := samples[299].Calories
+	hard := samples[599].Calories - easy
+	if hard <= easy {
+		t.Errorf("hard half burned %.1f kcal, easy half %.1f; want more when the HR is higher", hard, easy)
+	}
+}
+
+func TestApplyCaloriesUnknown(t *testing.T) {
+	w := &workout{samples: secondSamples(0, 60, steadyHR)}
+	applyCalories(w, 0, false, nil)
+	if w.hasCalories || w.calories != 0 {
+		t.Errorf("calories %d (has %v) without a total, series or profile", w.calories, w.hasCalories)
+	}
+}
+
+func TestLapCaloriesSumToSession(t *testing.T) {
+	w := &workout{samples: secondSamples(0, 600, func(i int) uint8 { return uint8(100 + i%60) })}
+	applyCalories(w, 77, false, nil)
+	laps := buildLaps(w, LapOptions{Every: 70 * time.Second})
+	sum := 0
+	for _, l := range laps {
+		sum += l.calories
+	}
+	if sum != 77 {
+		t.Errorf("laps sum to %d kcal, want the session's 77", sum)
+	}
+}
@@ -0,0 +1,202 @@
+package encoder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// CleanOptions configures heart rate cleaning. Zero fields disable the
+// corresponding step.
+type CleanOptions struct {
+	// MinHR and MaxHR are physiological bounds; samples outside are dropped.
+	MinHR, MaxHR uint8
+	// Samples more than SpikeThreshold bpm from the median of the
+	// surrounding SpikeWindow are dropped as optical glitches.
+	SpikeWindow    time.Duration
+	SpikeThreshold uint8
+	// MaxGap is the longest dropout filled in by linear interpolation.
+	// Longer gaps are left alone, as pauses.
+	MaxGap time.Duration
+	// Smoothing is the width of a centred moving average.
+	Smoothing time.Duration
+}
+
+var defaultClean = CleanOptions{
+	MinHR:          35,
+	MaxHR:          220,
+	SpikeWindow:    15 * time.Second,
+	SpikeThreshold: 30,
+	MaxGap:         10 * time.Second,
+}
+
+// CleanOptionsFor returns the default cleaning for an activity. Strength
+// and yoga sessions get a tighter spike threshold and light smoothing, since
+// wrist HR is least reliable when the wrist is flexed; interval-style cardio
+// gets a looser threshold so real surges are kept.
+func CleanOptionsFor(activityName string) CleanOptions {
+	opts := defaultClean
+	sport, subSport, _ := sportFor(activityName)
+	switch {
+	case subSport == fit.SubSportStrengthTraining, subSport == fit.SubSportYoga:
+		opts.SpikeThreshold = 25
+		opts.Smoothing = 5 * time.Second
+	case sport == fit.SportCycling, sport == fit.SportRunning:
+		opts.SpikeThreshold = 40
+	}
+	return opts
+}
+
+// CleanReport counts what Clean changed.
+type CleanReport struct {
+	OutOfBounds  int
+	Spikes       int
+	Interpolated int
+	Smoothed     time.Duration
+}
+
+func (r CleanReport) String() string {
+	var parts []string
+	if r.OutOfBounds > 0 {
+		parts = append(parts, fmt.Sprintf("dropped %d out-of-range", r.OutOfBounds))
+	}
+	if r.Spikes > 0 {
+		parts = append(parts, fmt.Sprintf("dropped %d spikes", r.Spikes))
+	}
+	if r.Interpolated > 0 {
+		parts = append(parts, fmt.Sprintf("interpolated %d", r.Interpolated))
+	}
+	if r.Smoothed > 0 {
+		parts = append(parts, fmt.Sprintf("smoothed over %s", r.Smoothed))
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Clean removes out-of-range and spike samples, fills short dropouts and
+// optionally smooths the heart rate. Samples must be in time order; the
+// input is not modified.
+func Clean(samples []Sample, opts CleanOptions) ([]Sample, CleanReport) {
+	var report CleanReport
+
+	// 1. Physiological bounds. Zero is a missing reading.
+	kept := make([]Sample, 0, len(samples))
+	for _, s := range samples {
+		if s.HeartRate == 0 || (opts.MinHR > 0 && s.HeartRate < opts.MinHR) || (opts.MaxHR > 0 && s.HeartRate > opts.MaxHR) {
+			report.OutOfBounds++
+			continue
+		}
+		kept = append(kept, s)
+	}
+
+	// 2. Spikes against a rolling median of the in-bounds samples.
+	if opts.SpikeWindow > 0 && opts.SpikeThreshold > 0 {
+		medians := rollingMedian(kept, opts.SpikeWindow)
+		filtered := kept[:0:0]
+		for i, s := range kept {
+			if diff := int(s.HeartRate) - int(medians[i]); diff > int(opts.SpikeThreshold) || -diff > int(opts.SpikeThreshold) {
+				report.Spikes++
+				continue
+			}
+			filtered = append(filtered, s)
+		}
+		kept = filtered
+	}
+
+	// 3. Interpolate short gaps at one-second steps.
+	if opts.MaxGap > 0 && len(kept) > 1 {
+		filled := make([]Sample, 0, len(kept))
+		for i, s := range kept {
+			if i > 0 {
+				prev := kept[i-1]
+				if gap := s.Time.Sub(prev.Time); gap > sampleDuration && gap <= opts.MaxGap {
+					for t := prev.Time.Add(sampleDuration); t.Before(s.Time); t = t.Add(sampleDuration) {
+						filled = append(filled, interpolateSample(prev, s, t))
+						report.Interpolated++
+					}
+				}
+			}
+			filled = append(filled, s)
+		}
+		kept = filled
+	}
+
+	// 4. Optional smoothing.
+	if opts.Smoothing > 0 {
+		kept = smoothSamples(kept, opts.Smoothing)
+		report.Smoothed = opts.Smoothing
+	}
+
+	return kept, report
+}
+
+// rollingMedian returns the median HR of the samples within window/2 of each
+// sample.
+func rollingMedian(samples []Sample, window time.Duration) []uint8 {
+	half := window / 2
+	medians := make([]uint8, len(samples))
+	lo, hi := 0, 0
+	var buf []uint8
+	for i, s := range samples {
+		for samples[lo].Time.Before(s.Time.Add(-half)) {
+			lo++
+		}
+		for hi < len(samples) && !samples[hi].Time.After(s.Time.Add(half)) {
+			hi++
+		}
+		buf = buf[:0]
+		for _, w := range samples[lo:hi] {
+			buf = append(buf, w.HeartRate)
+		}
+		sort.Slice(buf, func(a, b int) bool { return buf[a] < buf[b] })
+		medians[i] = buf[len(buf)/2]
+	}
+	return medians
+}
+
+// interpolateSample returns the sample at t on the line between a and b.
+// Without a fix at both ends, it keeps a's position, so a GPS track has no
+// holes where heart rate was filled in.
+func interpolateSample(a, b Sample, t time.Time) Sample {
+	frac := float64(t.Sub(a.Time)) / float64(b.Time.Sub(a.Time))
+	lerp := func(x, y float64) float64 { return x + (y-x)*frac }
+	s := Sample{
+		Time:      t,
+		HeartRate: uint8(lerp(float64(a.HeartRate), float64(b.HeartRate)) + 0.5),
+		Distance:  lerp(a.Distance, b.Distance),
+		Speed:     lerp(a.Speed, b.Speed),
+		Cadence:   lerp(a.Cadence, b.Cadence),
+		Calories:  lerp(a.Calories, b.Calories),
+		Latitude:  a.Latitude,
+		Longitude: a.Longitude,
+	}
+	if a.hasPosition() && b.hasPosition() {
+		s.Latitude, s.Longitude = lerp(a.Latitude, b.Latitude), lerp(a.Longitude, b.Longitude)
+	}
+	return s
+}
+
+// smoothSamples applies a centred moving average of the given width to HR.
+func smoothSamples(samples []Sample, window time.Duration) []Sample {
+	half := window / 2
+	out := make([]Sample, len(samples))
+	lo, hi, sum := 0, 0, 0
+	for i, s := range samples {
+		for hi < len(samples) && !samples[hi].Time.After(s.Time.Add(half)) {
+			sum += int(samples[hi].HeartRate)
+			hi++
+		}
+		for samples[lo].Time.Before(s.Time.Add(-half)) {
+			sum -= int(samples[lo].HeartRate)
+			lo++
+		}
+		out[i] = s
+		out[i].HeartRate = uint8((sum + (hi-lo)/2) / (hi - lo))
+	}
+	return out
+}
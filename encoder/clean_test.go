@@ -0,0 +1,121 @@
+package encoder
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// hrSamples returns a sample a second for each heart rate, skipping zeros
+// as missing seconds.
+func hrSamples(hrs ...uint8) []Sample {
+	var samples []Sample
+	for i, hr := range hrs {
+		if hr != 0 {
+			samples = append(samples, Sample{Time: lapStart.Add(time.Duration(i) * time.Second), HeartRate: hr})
+		}
+	}
+	return samples
+}
+
+func heartRates(samples []Sample) []uint8 {
+	hrs := make([]uint8, len(samples))
+	for i, s := range samples {
+		hrs[i] = s.HeartRate
+	}
+	return hrs
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []Sample
+		opts    CleanOptions
+		want    []uint8
+		report  CleanReport
+	}{
+		{
+			name:    "bounds",
+			samples: hrSamples(30, 120, 121, 250, 122),
+			opts:    CleanOptions{MinHR: 35, MaxHR: 220},
+			want:    []uint8{120, 121, 122},
+			report:  CleanReport{OutOfBounds: 2},
+		},
+		{
+			name:    "spike against the rolling median",
+			samples: hrSamples(120, 121, 122, 190, 123, 122, 121),
+			opts:    CleanOptions{SpikeWindow: 6 * time.Second, SpikeThreshold: 30},
+			want:    []uint8{120, 121, 122, 123, 122, 121},
+			report:  CleanReport{Spikes: 1},
+		},
+		{
+			name:    "a steady climb is not a spike",
+			samples: hrSamples(120, 130, 140, 150, 160, 170, 180),
+			opts:    CleanOptions{SpikeWindow: 6 * time.Second, SpikeThreshold: 30},
+			want:    []uint8{120, 130, 140, 150, 160, 170, 180},
+		},
+		{
+			name:    "short gap filled",
+			samples: hrSamples(120, 0, 0, 0, 140),
+			opts:    CleanOptions{MaxGap: 10 * time.Second},
+			want:    []uint8{120, 125, 130, 135, 140},
+			report:  CleanReport{Interpolated: 3},
+		},
+		{
+			name:    "long gap left as a pause",
+			samples: hrSamples(120, 0, 0, 0, 140),
+			opts:    CleanOptions{MaxGap: 3 * time.Second},
+			want:    []uint8{120, 140},
+		},
+		{
+			name:    "smoothing",
+			samples: hrSamples(120, 120, 150, 120, 120),
+			opts:    CleanOptions{Smoothing: 2 * time.Second},
+			want:    []uint8{120, 130, 130, 130, 120},
+			report:  CleanReport{Smoothed: 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := append([]Sample(nil), tt.samples...)
+			got, report := Clean(tt.samples, tt.opts)
+			if hrs := heartRates(got); string(hrs) != string(tt.want) {
+				t.Errorf("heart rate %v, want %v", hrs, tt.want)
+			}
+			if report != tt.report {
+				t.Errorf("report %+v, want %+v", report, tt.report)
+			}
+			for i := range got[1:] {
+				if !got[i+1].Time.After(got[i].Time) {
+					t.Fatalf("sample %d at %v is not after %v", i+1, got[i+1].Time, got[i].Time)
+				}
+			}
+			if string(heartRates(tt.samples)) != string(heartRates(before)) {
+				t.Error("Clean modified its input")
+			}
+		})
+	}
+}
+
+func TestCleanGapKeepsPosition(t *testing.T) {
+	samples := hrSamples(120, 0, 0, 0, 140, 0, 150)
+	samples[0].Latitude, samples[0].Longitude = 59.9, 10.7
+	samples[1].Latitude, samples[1].Longitude = 59.904, 10.704
+	// The last sample has no fix.
+
+	got, _ := Clean(samples, CleanOptions{MaxGap: 10 * time.Second})
+	if len(got) != 7 {
+		t.Fatalf("%d samples, want 7", len(got))
+	}
+	for i, s := range got[:6] {
+		if !s.hasPosition() {
+			t.Errorf("sample %d has no position", i)
+		}
+	}
+	if lat := got[2].Latitude; math.Abs(lat-59.902) > 1e-9 {
+		t.Errorf("latitude halfway through the gap %v, want 59.902", lat)
+	}
+	if got[5].Latitude != 59.904 || got[5].Longitude != 10.704 {
+		t.Errorf("sample before a point without a fix at %v,%v; want the last fix", got[5].Latitude, got[5].Longitude)
+	}
+}
@@ -1,70 +1,101 @@
 package encoder
 
 import (
-	"encoding/binary"
+	"bytes"
 	"fmt"
-	"os"
+	"io"
+	"log/slog"
+	"strconv"
 	"strings"
-	"time"
-
-	"fitbit-strava/fitbit"
 
 	"github.com/tormoder/fit"
 )
 
-func CreateFitFile(filename string, date, startTime, durationStr string, data *fitbit.HeartRateResponse, totalCalories int, source *fitbit.ActivityLogSource, activityName string) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %v", err)
-	}
-	defer f.Close()
-
-	// Parse base time
-	baseTime, err := time.Parse("2006-01-02 15:04", date+" "+startTime)
-	if err != nil {
-		return fmt.Errorf("failed to parse start time: %v", err)
-	}
+// Format is an output file format.
+type Format string
 
-	// Create FIT activity file
-	// Create Header
-	hdr := fit.NewHeader(fit.V20, true)
+const (
+	FormatFIT Format = "fit"
+	FormatTCX Format = "tcx"
+	FormatGPX Format = "gpx"
+)
 
-	fitFile, err := fit.NewFile(fit.FileTypeActivity, hdr)
-	if err != nil {
-		return fmt.Errorf("failed to create fit file: %v", err)
+// ParseFormat validates a format name from the command line.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatFIT, FormatTCX, FormatGPX:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (want fit, tcx or gpx)", s)
 	}
+}
 
-	// Add FileCreator message (Development Manufacturer)
-	fileCreator := fit.NewFileCreatorMsg()
-	fileCreator.SoftwareVersion = 1
-	fitFile.FileCreator = fileCreator
+// ParseManufacturer resolves a FIT manufacturer from its profile name, e.g.
+// "garmin", or its numeric id.
+func ParseManufacturer(s string) (fit.Manufacturer, error) {
+	if id, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return fit.Manufacturer(id), nil
+	}
+	name := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(s))
+	for m := fit.Manufacturer(1); m < fit.ManufacturerInvalid; m++ {
+		if strings.ToLower(m.String()) == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fit manufacturer %q", s)
+}
 
-	// Set FileId TimeCreated to Now (Export time)
-	fitFile.FileId.TimeCreated = time.Now()
-	fitFile.FileId.Manufacturer = fit.ManufacturerDevelopment
-	fitFile.FileId.Product = 0 // Generic
+// Options tunes how the activity file is built.
+type Options struct {
+	// Format selects the writer; the zero value writes FIT.
+	Format Format
+	Laps   LapOptions
+	// Profile enables HR-based calorie estimation when no activity log matched.
+	Profile *Profile
+}
 
-	activity, err := fitFile.Activity()
+// Encode writes the workout to w in opts.Format. FIT output is validated
+// with Inspect before it is written.
+func Encode(w io.Writer, wk Workout, opts Options) error {
+	prepared, err := prepare(wk, opts)
 	if err != nil {
-		return fmt.Errorf("failed to get activity: %v", err)
+		return err
 	}
-
-	// Add Device Info if available
-	if source != nil {
-		fitFile.FileId.ProductName = source.Name
-
-		devInfo := fit.NewDeviceInfoMsg()
-		devInfo.Timestamp = fitFile.FileId.TimeCreated
-		devInfo.ProductName = source.Name
-
-		activity.DeviceInfos = append(activity.DeviceInfos, devInfo)
+	slog.Debug("Encoding workout", "format", opts.Format, "sport", prepared.sport, "samples", len(prepared.samples),
+		"laps", len(prepared.laps), "events", len(prepared.events), "calories", prepared.calories, "duration", prepared.duration())
+
+	switch opts.Format {
+	case FormatTCX:
+		return writeTCX(w, prepared)
+	case FormatGPX:
+		return writeGPX(w, prepared)
+	default:
+		// Decode our own output before handing it over so we never upload a
+		// file that fails to read back.
+		var buf bytes.Buffer
+		if err := writeFIT(&buf, prepared); err != nil {
+			return err
+		}
+		if err := Validate(buf.Bytes()); err != nil {
+			return fmt.Errorf("self-check failed: %w", err)
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write fit file: %v", err)
+		}
+		return nil
 	}
+}
 
-	// Map Activity Name to Sport/SubSport
-	var sport fit.Sport
-	var subSport fit.SubSport
-	var sportName string
+// UsesSteps reports whether steps and distance are meaningful for the
+// activity. On a spin bike or in the gym, wrist steps are arm swings.
+func UsesSteps(activityName string) bool {
+	sport, _, _ := sportFor(activityName)
+	return sport == fit.SportRunning || sport == fit.SportWalking
+}
 
+// sportFor maps a Fitbit activity name to a FIT sport, sub-sport and
+// display name.
+func sportFor(activityName string) (sport fit.Sport, subSport fit.SubSport, sportName string) {
 	switch strings.ToLower(activityName) {
 	case "spinning":
 		sport = fit.SportCycling
@@ -109,75 +140,5 @@ func CreateFitFile(filename string, date, startTime, durationStr string, data *f
 		}
 	}
 
-	// Define Session
-	session := &fit.SessionMsg{
-		Sport:            sport,
-		SubSport:         subSport,
-		StartTime:        baseTime,
-		Timestamp:        baseTime,
-		TotalTimerTime:   0,
-		SportProfileName: sportName,
-	}
-
-	if totalCalories > 0 {
-		session.TotalCalories = uint16(totalCalories)
-	}
-
-	activity.Sessions = append(activity.Sessions, session)
-
-	// Map Samples to Records
-	count := 0
-	var totalHR uint64
-	var maxHR uint8
-	var minHR uint8 = 255
-
-	for _, s := range data.ActivitiesHeartIntraday.Dataset {
-		sampleTime, err := time.Parse("15:04:05", s.Time)
-		if err != nil {
-			continue
-		}
-
-		actualTime := time.Date(baseTime.Year(), baseTime.Month(), baseTime.Day(),
-			sampleTime.Hour(), sampleTime.Minute(), sampleTime.Second(), 0, time.Local)
-
-		hr := uint8(s.Value)
-		totalHR += uint64(hr)
-		if hr > maxHR {
-			maxHR = hr
-		}
-		if hr < minHR {
-			minHR = hr
-		}
-
-		rec := &fit.RecordMsg{
-			Timestamp: actualTime,
-			HeartRate: hr,
-			// Could also distribute calories here if we wanted to be precise, but session level is usually enough.
-		}
-		activity.Records = append(activity.Records, rec)
-		count++
-	}
-
-	if count > 0 {
-		// Update session timestamps based on first/last record
-		session.StartTime = activity.Records[0].Timestamp
-		session.Timestamp = activity.Records[count-1].Timestamp
-
-		duration := session.Timestamp.Sub(session.StartTime)
-		ms := uint32(duration.Milliseconds())
-
-		session.TotalTimerTime = ms
-		session.TotalElapsedTime = ms
-
-		session.AvgHeartRate = uint8(totalHR / uint64(count))
-		session.MaxHeartRate = maxHR
-		session.MinHeartRate = minHR
-	}
-
-	// Finalize and Encode
-	if err := fit.Encode(f, fitFile, binary.LittleEndian); err != nil {
-		return fmt.Errorf("failed to encode fit file: %v", err)
-	}
-
-	return nil
+	return sport, subSport, sportName
 }
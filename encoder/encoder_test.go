@@ -0,0 +1,90 @@
+package encoder
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// spinWorkout is ten minutes of heart rate with nothing else, as built from
+// Fitbit's intraday series.
+func spinWorkout() Workout {
+	return Workout{
+		Name:     "Spinning",
+		Samples:  secondSamples(0, 600, func(i int) uint8 { return uint8(110 + i/10) }),
+		Calories: 120,
+	}
+}
+
+func TestEncodeLeavesWorkoutUnchanged(t *testing.T) {
+	wk := spinWorkout()
+	before := append([]Sample(nil), wk.Samples...)
+	for _, format := range []Format{FormatFIT, FormatTCX} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, wk, Options{Format: format, Laps: LapOptions{Every: time.Minute}}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if buf.Len() == 0 {
+			t.Errorf("%s: nothing written", format)
+		}
+		if !reflect.DeepEqual(wk.Samples, before) {
+			t.Fatalf("%s: Encode modified the caller's samples", format)
+		}
+	}
+}
+
+func TestEncodeSourceLaps(t *testing.T) {
+	wk := spinWorkout()
+	wk.Laps = []Lap{
+		{Start: lapStart, End: lapStart.Add(200 * time.Second)},
+		{Start: lapStart.Add(200 * time.Second), End: lapStart.Add(400 * time.Second), Rest: true},
+		{Start: lapStart.Add(400 * time.Second), End: lapStart.Add(500 * time.Second)},
+	}
+	// Source laps win over the options.
+	opts := Options{Laps: LapOptions{Every: time.Minute}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, wk, opts); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Inspect(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fit.Intensity{fit.IntensityActive, fit.IntensityRest, fit.IntensityActive}
+	if len(report.Laps) != len(want) {
+		t.Fatalf("%d laps, want %d", len(report.Laps), len(want))
+	}
+	for i, l := range report.Laps {
+		if l.Intensity != want[i] {
+			t.Errorf("lap %d intensity %v, want %v", i, l.Intensity, want[i])
+		}
+	}
+	// The last lap stretches to the end of the session.
+	if got := report.Laps[2].TotalElapsedTime; got != 200000 {
+		t.Errorf("last lap lasts %d ms, want 200000", got)
+	}
+
+	buf.Reset()
+	opts.Format = FormatTCX
+	if err := Encode(&buf, wk, opts); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseTCX(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if laps := doc.Activities[0].Laps; len(laps) != 3 || laps[1].Intensity != "Resting" {
+		t.Errorf("tcx laps %+v, want 3 with the second resting", laps)
+	}
+}
+
+func TestEncodeWithoutSamples(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, Workout{Name: "Run"}, Options{}); err == nil {
+		t.Error("encoded a workout without samples")
+	}
+}
@@ -0,0 +1,340 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/tormoder/fit"
+	"github.com/tormoder/fit/dyncrc16"
+)
+
+// writeFIT encodes the workout as a FIT activity file. Messages are written
+// in the order devices record them:
+//
+//	FileId, FileCreator, DeviceInfo, Event (timer start),
+//	Record... Lap, Record... Lap, ..., Event (timer stop), Session, Activity
+//
+// with any pause events interleaved with the records by time.
+func writeFIT(out io.Writer, w *workout) error {
+	hdr := fit.NewHeader(fit.V20, true)
+
+	fitFile, err := fit.NewFile(fit.FileTypeActivity, hdr)
+	if err != nil {
+		return fmt.Errorf("failed to create fit file: %v", err)
+	}
+
+	// Add FileCreator message (Development Manufacturer)
+	fileCreator := fit.NewFileCreatorMsg()
+	fileCreator.SoftwareVersion = 1
+	fitFile.FileCreator = fileCreator
+
+	// Set FileId TimeCreated to Now (Export time)
+	manufacturer := w.device.Manufacturer
+	if manufacturer == 0 {
+		manufacturer = fit.ManufacturerDevelopment
+	}
+	fitFile.FileId.TimeCreated = time.Now()
+	fitFile.FileId.Manufacturer = manufacturer
+	fitFile.FileId.Product = w.device.Product
+	fitFile.FileId.ProductName = w.device.Name
+	if w.device.SerialNumber != 0 {
+		fitFile.FileId.SerialNumber = w.device.SerialNumber
+	}
+
+	b, err := newFitBuilder(fitFile)
+	if err != nil {
+		return err
+	}
+
+	devInfo := fit.NewDeviceInfoMsg()
+	devInfo.Timestamp = w.startTime()
+	devInfo.DeviceIndex = fit.DeviceIndexCreator
+	devInfo.Manufacturer = manufacturer
+	devInfo.Product = w.device.Product
+	if w.device.Name != "" {
+		devInfo.ProductName = w.device.Name
+	}
+	if w.device.SerialNumber != 0 {
+		devInfo.SerialNumber = w.device.SerialNumber
+	}
+	if w.device.SoftwareVersion > 0 {
+		// FIT stores the version scaled by 100.
+		devInfo.SoftwareVersion = uint16(math.Round(w.device.SoftwareVersion * 100))
+	}
+	if w.device.Battery != 0 {
+		devInfo.BatteryStatus = w.device.Battery
+	}
+	if err := b.add(func(a *fit.ActivityFile) { a.DeviceInfos = []*fit.DeviceInfoMsg{devInfo} }); err != nil {
+		return err
+	}
+
+	// Records and timer events, lap by lap, in time order.
+	events := timerEvents(w)
+	var maxSpeed uint16
+	var maxCadence uint8
+	for i, l := range w.laps {
+		var records []*fit.RecordMsg
+		flush := func() error {
+			if len(records) == 0 {
+				return nil
+			}
+			recs := records
+			records = nil
+			return b.add(func(a *fit.ActivityFile) { a.Records = recs })
+		}
+		for _, s := range w.samples[l.start:l.end] {
+			for len(events) > 0 && !events[0].Time.After(s.Time) {
+				if err := flush(); err != nil {
+					return err
+				}
+				if err := b.addEvent(fitTimerEvent(events[0])); err != nil {
+					return err
+				}
+				events = events[1:]
+			}
+			rec := fitRecord(w, s)
+			maxSpeed = max(maxSpeed, rec.Speed)
+			maxCadence = max(maxCadence, rec.Cadence)
+			records = append(records, rec)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		// The final timer stop comes before the last lap, as devices write it.
+		last := i == len(w.laps)-1
+		for len(events) > 0 && (last || events[0].Time.Before(l.endTime)) {
+			if err := b.addEvent(fitTimerEvent(events[0])); err != nil {
+				return err
+			}
+			events = events[1:]
+		}
+		msg := fitLap(w, i, l)
+		if err := b.add(func(a *fit.ActivityFile) { a.Laps = []*fit.LapMsg{msg} }); err != nil {
+			return err
+		}
+	}
+
+	elapsed := uint32(w.duration().Milliseconds())
+	timer := uint32(w.timerTime(w.startTime(), w.endTime()).Milliseconds())
+
+	session := fit.NewSessionMsg()
+	session.MessageIndex = 0
+	session.Event = fit.EventSession
+	session.EventType = fit.EventTypeStop
+	session.Trigger = fit.SessionTriggerActivityEnd
+	session.Sport = w.sport
+	session.SubSport = w.subSport
+	session.SportProfileName = w.sportName
+	session.StartTime = w.startTime()
+	session.Timestamp = w.endTime()
+	session.TotalElapsedTime = elapsed
+	session.TotalTimerTime = timer
+	session.FirstLapIndex = 0
+	session.NumLaps = uint16(len(w.laps))
+	session.AvgHeartRate, session.MaxHeartRate, session.MinHeartRate = heartRateStats(w.samples)
+
+	if w.calories > 0 {
+		session.TotalCalories = uint16(w.calories)
+	}
+	if w.hasDistance {
+		session.TotalDistance = uint32(w.distance() * 100)
+		if timer > 0 {
+			session.AvgSpeed = uint16(w.distance() / (float64(timer) / 1000) * 1000)
+		}
+		session.MaxSpeed = maxSpeed
+	}
+	if w.hasCadence {
+		if w.totalSteps > 0 {
+			session.TotalCycles = uint32(w.totalSteps / 2)
+			if timer > 0 {
+				session.AvgCadence = uint8(w.totalSteps / 2 / (float64(timer) / 60000))
+			}
+		}
+		session.MaxCadence = maxCadence
+	}
+
+	activity := fit.NewActivityMsg()
+	activity.Timestamp = w.endTime()
+	activity.TotalTimerTime = timer
+	activity.NumSessions = 1
+	activity.Type = fit.ActivityModeManual
+	activity.Event = fit.EventActivity
+	activity.EventType = fit.EventTypeStop
+	activity.LocalTimestamp = localTimestamp(w.endTime())
+
+	if err := b.add(func(a *fit.ActivityFile) { a.Sessions = []*fit.SessionMsg{session} }); err != nil {
+		return err
+	}
+	if err := b.add(func(a *fit.ActivityFile) { a.Activity = activity }); err != nil {
+		return err
+	}
+
+	return b.writeTo(out)
+}
+
+// fitBuilder assembles a FIT file message group by message group.
+// fit.Encode always writes an activity's messages grouped by type, so each
+// group is encoded as its own file and the data sections are spliced
+// together behind a shared FileId/FileCreator.
+type fitBuilder struct {
+	file   *fit.File
+	prefix []byte // encoded FileId and FileCreator
+	data   bytes.Buffer
+}
+
+func newFitBuilder(file *fit.File) (*fitBuilder, error) {
+	b := &fitBuilder{file: file}
+	prefix, err := b.encode(func(*fit.ActivityFile) {})
+	if err != nil {
+		return nil, err
+	}
+	b.prefix = prefix
+	return b, nil
+}
+
+// encode encodes the FileId, FileCreator and the messages set by fill, and
+// returns the data section without header and CRC.
+func (b *fitBuilder) encode(fill func(*fit.ActivityFile)) ([]byte, error) {
+	activity, err := b.file.Activity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity: %v", err)
+	}
+	*activity = fit.ActivityFile{}
+	fill(activity)
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, b.file, binary.LittleEndian); err != nil {
+		return nil, fmt.Errorf("failed to encode fit file: %v", err)
+	}
+	data := buf.Bytes()
+	headerSize := int(data[0])
+	return data[headerSize : headerSize+int(b.file.Header.DataSize)], nil
+}
+
+// add appends the messages set by fill.
+func (b *fitBuilder) add(fill func(*fit.ActivityFile)) error {
+	data, err := b.encode(fill)
+	if err != nil {
+		return err
+	}
+	b.data.Write(data[len(b.prefix):])
+	return nil
+}
+
+func (b *fitBuilder) addEvent(e *fit.EventMsg) error {
+	return b.add(func(a *fit.ActivityFile) { a.Events = []*fit.EventMsg{e} })
+}
+
+// writeTo writes the header, FileId, FileCreator, the added messages and the
+// file CRC.
+func (b *fitBuilder) writeTo(out io.Writer) error {
+	hdr := fit.NewHeader(fit.V20, true)
+	hdr.DataSize = uint32(len(b.prefix) + b.data.Len())
+	hdrBytes, err := hdr.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode fit header: %v", err)
+	}
+
+	crc := dyncrc16.New()
+	var file bytes.Buffer
+	for _, part := range [][]byte{hdrBytes, b.prefix, b.data.Bytes()} {
+		file.Write(part)
+		crc.Write(part)
+	}
+	file.Write(binary.LittleEndian.AppendUint16(nil, crc.Sum16()))
+
+	if _, err := out.Write(file.Bytes()); err != nil {
+		return fmt.Errorf("failed to write fit file: %v", err)
+	}
+	return nil
+}
+
+// timerEvents returns the workout's timer events bracketed by a start at the
+// session start and a stop at the session end.
+func timerEvents(w *workout) []Event {
+	events := w.events
+	if len(events) == 0 || events[0].Type != EventStart || events[0].Time.After(w.startTime()) {
+		events = append([]Event{{Time: w.startTime(), Type: EventStart}}, events...)
+	}
+	if last := events[len(events)-1]; last.Type != EventStop {
+		events = append(events, Event{Time: w.endTime(), Type: EventStop})
+	}
+	return events
+}
+
+// localTimestamp expresses t's wall clock as a FIT timestamp, which is how
+// the activity's local_timestamp field is defined.
+func localTimestamp(t time.Time) time.Time {
+	_, offset := t.Zone()
+	return t.UTC().Add(time.Duration(offset) * time.Second)
+}
+
+func fitRecord(w *workout, s Sample) *fit.RecordMsg {
+	// Start from invalid values so unset fields (distance, cadence) are omitted.
+	rec := fit.NewRecordMsg()
+	rec.Timestamp = s.Time
+	rec.HeartRate = s.HeartRate
+	if s.hasPosition() {
+		rec.PositionLat = fit.NewLatitudeDegrees(s.Latitude)
+		rec.PositionLong = fit.NewLongitudeDegrees(s.Longitude)
+	}
+	if w.hasDistance {
+		rec.Distance = uint32(s.Distance * 100)
+		rec.Speed = uint16(s.Speed * 1000)
+	}
+	if w.hasCadence {
+		// FIT counts strides (one per two steps) for running and walking.
+		rec.Cadence = uint8(s.Cadence / 2)
+	}
+	if w.hasCalories {
+		rec.Calories = uint16(math.Round(s.Calories))
+	}
+	return rec
+}
+
+func fitLap(w *workout, index int, l lap) *fit.LapMsg {
+	msg := fit.NewLapMsg()
+	msg.MessageIndex = fit.MessageIndex(index)
+	msg.Event = fit.EventLap
+	msg.EventType = fit.EventTypeStop
+	msg.Intensity = l.intensity
+	msg.LapTrigger = l.trigger
+	msg.Sport = w.sport
+	msg.SubSport = w.subSport
+	msg.StartTime = l.startTime
+	msg.Timestamp = l.endTime
+
+	msg.TotalElapsedTime = uint32(l.endTime.Sub(l.startTime).Milliseconds())
+	ms := uint32(w.timerTime(l.startTime, l.endTime).Milliseconds())
+	msg.TotalTimerTime = ms
+	msg.AvgHeartRate = l.avgHR
+	msg.MaxHeartRate = l.maxHR
+
+	if l.distance > 0 {
+		msg.TotalDistance = uint32(l.distance * 100)
+		if ms > 0 {
+			msg.AvgSpeed = uint16(l.distance / (float64(ms) / 1000) * 1000)
+		}
+	}
+	if l.calories > 0 {
+		msg.TotalCalories = uint16(l.calories)
+	}
+
+	return msg
+}
+
+func fitTimerEvent(e Event) *fit.EventMsg {
+	msg := fit.NewEventMsg()
+	msg.Timestamp = e.Time
+	msg.Event = fit.EventTimer
+	msg.EventType = fit.EventTypeStart
+	if e.Type == EventStop {
+		msg.EventType = fit.EventTypeStopAll
+	}
+	msg.EventGroup = 0
+	return msg
+}
@@ -0,0 +1,116 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+)
+
+// FIT global message numbers.
+const (
+	mesgFileID      = 0
+	mesgSession     = 18
+	mesgLap         = 19
+	mesgRecord      = 20
+	mesgEvent       = 21
+	mesgDeviceInfo  = 23
+	mesgActivity    = 34
+	mesgFileCreator = 49
+)
+
+// messageOrder returns the global message numbers of a FIT file's data
+// messages in file order, with runs of the same message collapsed. The
+// decoder groups messages by type, so this walks the records itself.
+func messageOrder(t *testing.T, data []byte) []uint16 {
+	t.Helper()
+	headerSize := int(data[0])
+	body := data[headerSize : headerSize+int(binary.LittleEndian.Uint32(data[4:8]))]
+
+	type definition struct {
+		global uint16
+		size   int
+	}
+	defs := map[byte]definition{}
+	var order []uint16
+	for len(body) > 0 {
+		h := body[0]
+		body = body[1:]
+		switch {
+		case h&0x80 != 0: // compressed timestamp header
+			def := defs[h>>5&0x3]
+			order = append(order, def.global)
+			body = body[def.size:]
+		case h&0x40 != 0: // definition message
+			def := definition{global: binary.LittleEndian.Uint16(body[2:4])}
+			if body[1] == 1 {
+				def.global = binary.BigEndian.Uint16(body[2:4])
+			}
+			n := int(body[4])
+			fields := body[5 : 5+3*n]
+			body = body[5+3*n:]
+			for i := 0; i < n; i++ {
+				def.size += int(fields[3*i+1])
+			}
+			if h&0x20 != 0 {
+				n := int(body[0])
+				for i := 0; i < n; i++ {
+					def.size += int(body[1+3*i+1])
+				}
+				body = body[1+3*n:]
+			}
+			defs[h&0x0F] = def
+		default:
+			def, ok := defs[h&0x0F]
+			if !ok {
+				t.Fatalf("data message for undefined local type %d", h&0x0F)
+			}
+			order = append(order, def.global)
+			body = body[def.size:]
+		}
+	}
+	return slices.Compact(order)
+}
+
+func TestFITMessageOrder(t *testing.T) {
+	// Ten minutes with a one minute pause from 200s, split every 5 minutes.
+	wk := Workout{
+		Name:    "Spinning",
+		Samples: append(secondSamples(0, 200, steadyHR), secondSamples(260, 600, steadyHR)...),
+		Events: []Event{
+			{Time: lapStart.Add(200 * time.Second), Type: EventStop},
+			{Time: lapStart.Add(260 * time.Second), Type: EventStart},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, wk, Options{Laps: LapOptions{Every: 5 * time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint16{
+		mesgFileID, mesgFileCreator, mesgDeviceInfo,
+		mesgEvent, mesgRecord, // timer start, records to the pause
+		mesgEvent, mesgRecord, mesgLap, // stop and start, first lap
+		mesgRecord, mesgEvent, mesgLap, // second lap; timer stop before its lap
+		mesgSession, mesgActivity,
+	}
+	if got := messageOrder(t, buf.Bytes()); !slices.Equal(got, want) {
+		t.Errorf("messages %v,\nwant     %v", got, want)
+	}
+
+	report, err := Inspect(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := report.Sessions[0]
+	if s.TotalElapsedTime != 600000 || s.TotalTimerTime != 540000 {
+		t.Errorf("session elapsed %d ms, timer %d ms; want 600000 and 540000 without the pause", s.TotalElapsedTime, s.TotalTimerTime)
+	}
+	if s.NumLaps != 2 || report.Activity.NumSessions != 1 || report.Activity.TotalTimerTime != 540000 {
+		t.Errorf("session has %d laps, activity %d sessions and %d ms", s.NumLaps, report.Activity.NumSessions, report.Activity.TotalTimerTime)
+	}
+	if !s.StartTime.Equal(lapStart) || !report.Activity.Timestamp.Equal(lapStart.Add(600*time.Second)) {
+		t.Errorf("session starts %v, activity ends %v", s.StartTime, report.Activity.Timestamp)
+	}
+}
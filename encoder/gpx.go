@@ -0,0 +1,100 @@
+package encoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GPX document types with the Garmin TrackPointExtension for HR and cadence.
+type gpxDoc struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsTPX string      `xml:"xmlns:gpxtpx,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Track    gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Time string `xml:"time"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Type     string       `xml:"type"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// gpxPoint is a track point. GPX requires lat and lon, so workouts without
+// positions can't be written as GPX.
+type gpxPoint struct {
+	Lat        float64       `xml:"lat,attr"`
+	Lon        float64       `xml:"lon,attr"`
+	Time       string        `xml:"time"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointExtension struct {
+	HeartRate int  `xml:"gpxtpx:hr"`
+	Cadence   *int `xml:"gpxtpx:cad,omitempty"`
+}
+
+// writeGPX encodes the workout as a GPX 1.1 track. Each lap becomes a track
+// segment. Samples without a fix are left out, as GPX has no point without
+// a position.
+func writeGPX(out io.Writer, w *workout) error {
+	doc := gpxDoc{
+		Version:  "1.1",
+		Creator:  "fitbit-strava",
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsTPX: "http://www.garmin.com/xmlschemas/TrackPointExtension/v1",
+		Metadata: gpxMetadata{Time: w.startTime().UTC().Format(time.RFC3339)},
+		Track: gpxTrack{
+			Name: w.sportName,
+			Type: strings.ToLower(w.sport.String()),
+		},
+	}
+
+	for _, l := range w.laps {
+		var seg gpxSegment
+		for _, s := range w.samples[l.start:l.end] {
+			if !s.hasPosition() {
+				continue
+			}
+			pt := gpxPoint{Lat: s.Latitude, Lon: s.Longitude, Time: s.Time.UTC().Format(time.RFC3339)}
+			pt.Extensions.TrackPoint.HeartRate = int(s.HeartRate)
+			if w.hasCadence {
+				c := int(s.Cadence / 2)
+				pt.Extensions.TrackPoint.Cadence = &c
+			}
+			seg.Points = append(seg.Points, pt)
+		}
+		if len(seg.Points) > 0 {
+			doc.Track.Segments = append(doc.Track.Segments, seg)
+		}
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode gpx: %v", err)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return fmt.Errorf("failed to write gpx: %v", err)
+	}
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed to write gpx: %v", err)
+	}
+	return nil
+}
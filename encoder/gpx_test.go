@@ -0,0 +1,63 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func gpxWorkout(withPosition bool) Workout {
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	wk := Workout{Name: "Run"}
+	for i := range 120 {
+		s := Sample{Time: start.Add(time.Duration(i) * time.Second), HeartRate: 140}
+		if withPosition {
+			s.Latitude, s.Longitude = 59.9+float64(i)*1e-5, 10.7
+		}
+		wk.Samples = append(wk.Samples, s)
+	}
+	return wk
+}
+
+func TestGPXWithoutPositions(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, gpxWorkout(false), Options{Format: FormatGPX})
+	if !errors.Is(err, ErrNoPosition) {
+		t.Fatalf("Encode = %v, want ErrNoPosition", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes for a rejected workout", buf.Len())
+	}
+}
+
+func TestGPXPointsHavePositions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, gpxWorkout(true), Options{Format: FormatGPX}); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Segments []struct {
+			Points []struct {
+				Lat *float64 `xml:"lat,attr"`
+				Lon *float64 `xml:"lon,attr"`
+			} `xml:"trkpt"`
+		} `xml:"trk>trkseg"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, seg := range doc.Segments {
+		for _, pt := range seg.Points {
+			if pt.Lat == nil || pt.Lon == nil {
+				t.Fatalf("trkpt %d has no lat/lon", n)
+			}
+			n++
+		}
+	}
+	if n != 120 {
+		t.Errorf("%d track points, want 120", n)
+	}
+}
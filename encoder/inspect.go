@@ -0,0 +1,177 @@
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tormoder/fit"
+)
+
+// Severity of a problem found while inspecting a FIT file.
+type Severity int
+
+const (
+	// SeverityWarning marks problems some consumers tolerate.
+	SeverityWarning Severity = iota
+	// SeverityError marks problems that make the file unusable.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// MarshalText encodes s as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Problem is a protocol or content issue in a FIT file.
+type Problem struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// HRBucket counts records whose heart rate falls in [Low, Low+10).
+type HRBucket struct {
+	Low   int `json:"low"`
+	Count int `json:"count"`
+}
+
+// Report summarises a decoded FIT activity file.
+type Report struct {
+	FileID    fit.FileIdMsg
+	Activity  *fit.ActivityMsg
+	Devices   []*fit.DeviceInfoMsg
+	Sessions  []*fit.SessionMsg
+	Laps      []*fit.LapMsg
+	Events    []*fit.EventMsg
+	Records   int
+	Histogram []HRBucket
+	Problems  []Problem
+}
+
+// Inspect decodes a FIT activity file and checks it for the problems that
+// make consumers reject or mis-read it. A decode failure (bad header, CRC,
+// truncated data) is returned as an error.
+func Inspect(r io.Reader) (*Report, error) {
+	file, err := fit.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fit file: %v", err)
+	}
+
+	report := &Report{FileID: file.FileId}
+	problem := func(sev Severity, format string, args ...any) {
+		report.Problems = append(report.Problems, Problem{Severity: sev, Message: fmt.Sprintf(format, args...)})
+	}
+
+	activity, err := file.Activity()
+	if err != nil {
+		problem(SeverityError, "file type is %v, not activity", file.Type())
+		return report, nil
+	}
+
+	report.Activity = activity.Activity
+	report.Devices = activity.DeviceInfos
+	report.Sessions = activity.Sessions
+	report.Laps = activity.Laps
+	report.Events = activity.Events
+	report.Records = len(activity.Records)
+
+	if activity.Activity == nil {
+		problem(SeverityWarning, "missing Activity message")
+	} else if int(activity.Activity.NumSessions) != len(activity.Sessions) {
+		problem(SeverityWarning, "Activity reports %d sessions, file has %d", activity.Activity.NumSessions, len(activity.Sessions))
+	}
+	if len(activity.Sessions) == 0 {
+		problem(SeverityError, "no Session message")
+	}
+	if len(activity.Laps) == 0 {
+		problem(SeverityWarning, "no Lap messages")
+	}
+	if len(activity.Records) == 0 {
+		problem(SeverityError, "no Record messages")
+	}
+
+	for i, s := range activity.Sessions {
+		if s.TotalElapsedTime == 0 || !s.Timestamp.After(s.StartTime) {
+			problem(SeverityError, "session %d has zero length", i)
+		}
+	}
+
+	// Trainer apps often write several records a second, which consumers
+	// accept; only time going backwards is an error.
+	duplicates := 0
+	for i := 1; i < len(activity.Records); i++ {
+		prev, cur := activity.Records[i-1].Timestamp, activity.Records[i].Timestamp
+		if cur.Equal(prev) {
+			duplicates++
+		} else if cur.Before(prev) {
+			problem(SeverityError, "non-monotonic record timestamp at record %d (%s after %s)",
+				i, cur.Format("15:04:05"), prev.Format("15:04:05"))
+			break
+		}
+	}
+	if duplicates > 0 {
+		problem(SeverityWarning, "%d records repeat the previous record's timestamp", duplicates)
+	}
+
+	if len(activity.Records) > 0 && len(activity.Sessions) > 0 {
+		last := activity.Records[len(activity.Records)-1].Timestamp
+		if s := activity.Sessions[0]; s.Timestamp.Before(last) {
+			problem(SeverityWarning, "session ends at %s before the last record at %s",
+				s.Timestamp.Format("15:04:05"), last.Format("15:04:05"))
+		}
+	}
+
+	report.Histogram = heartRateHistogram(activity.Records)
+
+	return report, nil
+}
+
+// Err returns the error-level problems as a single error, or nil.
+func (r *Report) Err() error {
+	var msgs []string
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			msgs = append(msgs, p.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid fit file: %s", strings.Join(msgs, "; "))
+}
+
+// Validate decodes an encoded FIT file and returns an error if it has
+// error-level problems.
+func Validate(data []byte) error {
+	report, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+func heartRateHistogram(records []*fit.RecordMsg) []HRBucket {
+	counts := map[int]int{}
+	lo, hi := 255, 0
+	for _, r := range records {
+		if r.HeartRate == 0xFF {
+			continue
+		}
+		b := int(r.HeartRate) / 10 * 10
+		counts[b]++
+		lo, hi = min(lo, b), max(hi, b)
+	}
+	var buckets []HRBucket
+	for b := lo; b <= hi; b += 10 {
+		buckets = append(buckets, HRBucket{Low: b, Count: counts[b]})
+	}
+	return buckets
+}
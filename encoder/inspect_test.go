@@ -0,0 +1,101 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+func encodeFIT(t *testing.T, wk Workout) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, wk, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rawActivity encodes an activity file holding only the given records, as
+// a broken exporter might.
+func rawActivity(t *testing.T, times ...time.Time) []byte {
+	t.Helper()
+	file, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activity, err := file.Activity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range times {
+		rec := fit.NewRecordMsg()
+		rec.Timestamp = at
+		rec.HeartRate = 120
+		activity.Records = append(activity.Records, rec)
+	}
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectOwnOutput(t *testing.T) {
+	data := encodeFIT(t, spinWorkout())
+	if err := Validate(data); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("problems in our own output: %v", report.Problems)
+	}
+	counted := 0
+	for _, b := range report.Histogram {
+		counted += b.Count
+	}
+	if report.Records != 600 || counted != 600 {
+		t.Errorf("%d records, %d in the histogram; want 600", report.Records, counted)
+	}
+}
+
+func TestInspectCorrupt(t *testing.T) {
+	data := encodeFIT(t, spinWorkout())
+	data[len(data)/2] ^= 0xFF
+	if _, err := Inspect(bytes.NewReader(data)); err == nil {
+		t.Error("no error for a file with a bad CRC")
+	}
+	if _, err := Inspect(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Error("no error for a truncated file")
+	}
+}
+
+func TestInspectProblems(t *testing.T) {
+	data := rawActivity(t, lapStart, lapStart.Add(2*time.Second), lapStart.Add(time.Second))
+	report, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = report.Err()
+	if err == nil {
+		t.Fatal("no error for a file without a session and with records out of order")
+	}
+	for _, want := range []string{"no Session message", "non-monotonic record timestamp at record 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v lacks %q", err, want)
+		}
+	}
+	warned := false
+	for _, p := range report.Problems {
+		warned = warned || p.Severity == SeverityWarning && p.Message == "no Lap messages"
+	}
+	if !warned {
+		t.Errorf("problems %v lack the missing laps warning", report.Problems)
+	}
+}
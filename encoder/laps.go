@@ -0,0 +1,202 @@
+package encoder
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// LapOptions controls how the session is split into laps. The zero value
+// writes a single lap covering the whole session.
+type LapOptions struct {
+	// Every splits the session into fixed-length laps (e.g. 5m). Zero disables.
+	Every time.Duration
+	// DetectIntervals derives work/rest laps from the heart rate curve.
+	// Ignored when Every is set.
+	DetectIntervals bool
+}
+
+const (
+	// Window used to smooth HR before classifying work/rest.
+	intervalSmoothing = 30 * time.Second
+	// Segments shorter than this are folded into their neighbours.
+	minIntervalLength = 45 * time.Second
+	// Minimum spread between rest and work HR before we trust the detection.
+	minIntervalSpread = 15.0
+)
+
+// lapSplit is a half-open range of sample indexes [start, end).
+type lapSplit struct {
+	start, end int
+	intensity  fit.Intensity
+	trigger    fit.LapTrigger
+}
+
+// buildLaps splits the workout according to opts and returns one lap per
+// split, each carrying its own HR stats and share of the distance and
+// calories. Samples must already carry accumulated calories and distance.
+func buildLaps(w *workout, opts LapOptions) []lap {
+	samples := w.samples
+
+	var splits []lapSplit
+	switch {
+	case opts.Every > 0:
+		splits = fixedSplits(samples, opts.Every)
+	case opts.DetectIntervals:
+		splits = intervalSplits(samples)
+	}
+	if len(splits) == 0 {
+		splits = []lapSplit{{start: 0, end: len(samples), intensity: fit.IntensityActive}}
+	}
+	splits[len(splits)-1].trigger = fit.LapTriggerSessionEnd
+
+	return lapsFromSplits(w, splits)
+}
+
+// lapsFromSplits computes each lap's stats over its sample range.
+func lapsFromSplits(w *workout, splits []lapSplit) []lap {
+	samples := w.samples
+
+	// at returns the sample where a lap ending before index i stops.
+	at := func(i int) Sample { return samples[min(i, len(samples)-1)] }
+
+	laps := make([]lap, 0, len(splits))
+	for _, s := range splits {
+		l := lap{
+			start:     s.start,
+			end:       s.end,
+			startTime: samples[s.start].Time,
+			endTime:   w.timeAt(s.end),
+			intensity: s.intensity,
+			trigger:   s.trigger,
+		}
+		l.avgHR, l.maxHR, _ = heartRateStats(samples[s.start:s.end])
+
+		if w.hasDistance {
+			l.distance = at(s.end).Distance - samples[s.start].Distance
+		}
+		// Samples carry accumulated calories, so the lap share is the
+		// difference. Rounding the running totals keeps laps summing to the session.
+		if w.hasCalories {
+			l.calories = int(math.Round(calorieAt(samples, s.end))) - int(math.Round(calorieAt(samples, s.start)))
+		}
+
+		laps = append(laps, l)
+	}
+
+	return laps
+}
+
+// calorieAt returns the calories accumulated before sample i. Index
+// len(samples) is the session total.
+func calorieAt(samples []Sample, i int) float64 {
+	if i == 0 {
+		return 0
+	}
+	return samples[min(i, len(samples))-1].Calories
+}
+
+// fixedSplits cuts the samples every d from the first sample.
+func fixedSplits(samples []Sample, d time.Duration) []lapSplit {
+	var splits []lapSplit
+	next := samples[0].Time.Add(d)
+	start := 0
+	for i, r := range samples {
+		if r.Time.Before(next) {
+			continue
+		}
+		splits = append(splits, lapSplit{start: start, end: i, intensity: fit.IntensityActive, trigger: fit.LapTriggerTime})
+		start = i
+		// Skip boundaries that fall inside a gap in the data.
+		for !r.Time.Before(next) {
+			next = next.Add(d)
+		}
+	}
+	splits = append(splits, lapSplit{start: start, end: len(samples), intensity: fit.IntensityActive, trigger: fit.LapTriggerTime})
+	return splits
+}
+
+// intervalSplits classifies each sample as work or rest by comparing the
+// smoothed HR against the midpoint of the session's low and high HR, then
+// merges runs that are too short to be a real interval. It returns nil for
+// steady-state sessions where no clear work/rest pattern exists.
+func intervalSplits(samples []Sample) []lapSplit {
+	smoothed := smoothHR(samples, intervalSmoothing)
+
+	sorted := append([]float64(nil), smoothed...)
+	sort.Float64s(sorted)
+	low := sorted[len(sorted)*20/100]
+	high := sorted[len(sorted)*80/100]
+	if high-low < minIntervalSpread {
+		return nil
+	}
+	threshold := (low + high) / 2
+
+	var splits []lapSplit
+	for i, hr := range smoothed {
+		intensity := fit.IntensityRest
+		if hr >= threshold {
+			intensity = fit.IntensityActive
+		}
+		if len(splits) > 0 && splits[len(splits)-1].intensity == intensity {
+			splits[len(splits)-1].end = i + 1
+			continue
+		}
+		splits = append(splits, lapSplit{start: i, end: i + 1, intensity: intensity, trigger: fit.LapTriggerManual})
+	}
+
+	// Fold short segments into the previous one until everything is long enough.
+	for merged := true; merged && len(splits) > 1; {
+		merged = false
+		for i := 0; i < len(splits); i++ {
+			s := splits[i]
+			length := samples[s.end-1].Time.Sub(samples[s.start].Time)
+			if length >= minIntervalLength {
+				continue
+			}
+			if i == 0 {
+				splits[1].start = s.start
+			} else {
+				splits[i-1].end = s.end
+			}
+			splits = append(splits[:i], splits[i+1:]...)
+			merged = true
+			break
+		}
+		// Neighbours with the same intensity become one lap.
+		for i := 1; i < len(splits); i++ {
+			if splits[i].intensity == splits[i-1].intensity {
+				splits[i-1].end = splits[i].end
+				splits = append(splits[:i], splits[i+1:]...)
+				i--
+			}
+		}
+	}
+
+	if len(splits) < 2 {
+		return nil
+	}
+	return splits
+}
+
+// smoothHR returns a centred rolling mean of the HR over window.
+func smoothHR(samples []Sample, window time.Duration) []float64 {
+	out := make([]float64, len(samples))
+	half := window / 2
+	lo, hi := 0, 0
+	var sum float64
+	for i, s := range samples {
+		for hi < len(samples) && samples[hi].Time.Sub(s.Time) <= half {
+			sum += float64(samples[hi].HeartRate)
+			hi++
+		}
+		for s.Time.Sub(samples[lo].Time) > half {
+			sum -= float64(samples[lo].HeartRate)
+			lo++
+		}
+		out[i] = sum / float64(hi-lo)
+	}
+	return out
+}
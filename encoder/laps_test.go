@@ -0,0 +1,125 @@
+package encoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+var lapStart = time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+
+// secondSamples returns a sample every second for each offset in [from, to)
+// seconds, with heart rate hr(offset).
+func secondSamples(from, to int, hr func(int) uint8) []Sample {
+	var samples []Sample
+	for i := from; i < to; i++ {
+		samples = append(samples, Sample{Time: lapStart.Add(time.Duration(i) * time.Second), HeartRate: hr(i)})
+	}
+	return samples
+}
+
+func steadyHR(int) uint8 { return 130 }
+
+func TestFixedSplits(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []Sample
+		every   time.Duration
+		want    [][2]int
+	}{
+		{
+			name:    "boundary sample starts the next lap",
+			samples: secondSamples(0, 600, steadyHR),
+			every:   5 * time.Minute,
+			want:    [][2]int{{0, 300}, {300, 600}},
+		},
+		{
+			name:    "trailing partial lap",
+			samples: secondSamples(0, 420, steadyHR),
+			every:   3 * time.Minute,
+			want:    [][2]int{{0, 180}, {180, 360}, {360, 420}},
+		},
+		{
+			name:    "shorter than one lap",
+			samples: secondSamples(0, 90, steadyHR),
+			every:   5 * time.Minute,
+			want:    [][2]int{{0, 90}},
+		},
+		{
+			// Boundaries stay on the minute from the start; the ones at
+			// 120s to 360s fall in the gap and are skipped.
+			name:    "boundaries inside a gap",
+			samples: append(secondSamples(0, 100, steadyHR), secondSamples(400, 500, steadyHR)...),
+			every:   time.Minute,
+			want:    [][2]int{{0, 60}, {60, 100}, {100, 120}, {120, 180}, {180, 200}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splits := fixedSplits(tt.samples, tt.every)
+			if len(splits) != len(tt.want) {
+				t.Fatalf("%d splits %v, want %v", len(splits), splits, tt.want)
+			}
+			for i, s := range splits {
+				if s.start != tt.want[i][0] || s.end != tt.want[i][1] {
+					t.Errorf("split %d = [%d, %d), want %v", i, s.start, s.end, tt.want[i])
+				}
+				if s.trigger != fit.LapTriggerTime {
+					t.Errorf("split %d trigger %v, want time", i, s.trigger)
+				}
+			}
+		})
+	}
+}
+
+func TestIntervalSplits(t *testing.T) {
+	// Two minutes hard, two minutes easy, five times over.
+	samples := secondSamples(0, 600, func(i int) uint8 {
+		if i/120%2 == 0 {
+			return 165
+		}
+		return 110
+	})
+	splits := intervalSplits(samples)
+	if len(splits) != 5 {
+		t.Fatalf("%d splits %v, want 5", len(splits), splits)
+	}
+	for i, s := range splits {
+		want := fit.IntensityActive
+		if i%2 == 1 {
+			want = fit.IntensityRest
+		}
+		if s.intensity != want {
+			t.Errorf("split %d intensity %v, want %v", i, s.intensity, want)
+		}
+		// The smoothing window blurs each edge by at most half its width.
+		if edge := samples[s.start].Time.Sub(lapStart); i > 0 && (edge < time.Duration(i*120-15)*time.Second || edge > time.Duration(i*120+15)*time.Second) {
+			t.Errorf("split %d starts at %v, want about %ds", i, edge, i*120)
+		}
+	}
+	if splits[0].start != 0 || splits[len(splits)-1].end != len(samples) {
+		t.Errorf("splits cover [%d, %d), want all %d samples", splits[0].start, splits[len(splits)-1].end, len(samples))
+	}
+}
+
+func TestIntervalSplitsSteady(t *testing.T) {
+	samples := secondSamples(0, 600, func(i int) uint8 { return uint8(128 + i%5) })
+	if splits := intervalSplits(samples); splits != nil {
+		t.Errorf("steady session split into %v", splits)
+	}
+}
+
+func TestBuildLapsEndsWithSessionEnd(t *testing.T) {
+	w := &workout{samples: secondSamples(0, 420, steadyHR)}
+	laps := buildLaps(w, LapOptions{Every: 3 * time.Minute})
+	if len(laps) != 3 {
+		t.Fatalf("%d laps, want 3", len(laps))
+	}
+	if laps[2].trigger != fit.LapTriggerSessionEnd || laps[0].trigger != fit.LapTriggerTime {
+		t.Errorf("triggers %v, %v; want time then session end", laps[0].trigger, laps[2].trigger)
+	}
+	if !laps[2].endTime.After(laps[2].startTime) {
+		t.Errorf("last lap %v to %v", laps[2].startTime, laps[2].endTime)
+	}
+}
@@ -0,0 +1,270 @@
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// MaxMatchOffset is how far a sample may be from a record or trackpoint and
+// still be used for it.
+const MaxMatchOffset = 5 * time.Second
+
+// heartRateLookup returns a function that finds the sample nearest to t,
+// within MaxMatchOffset.
+func heartRateLookup(samples []Sample) func(t time.Time) (uint8, bool) {
+	bySecond := make(map[int64]uint8, len(samples))
+	for _, s := range samples {
+		bySecond[s.Time.Unix()] = s.HeartRate
+	}
+	return func(t time.Time) (uint8, bool) {
+		for d := int64(0); d <= int64(MaxMatchOffset/time.Second); d++ {
+			if v, ok := bySecond[t.Unix()-d]; ok {
+				return v, true
+			}
+			if v, ok := bySecond[t.Unix()+d]; ok {
+				return v, true
+			}
+		}
+		return 0, false
+	}
+}
+
+// IsFIT reports whether data starts with a FIT file header.
+func IsFIT(data []byte) bool {
+	return len(data) >= 12 && string(data[8:12]) == ".FIT"
+}
+
+// Span returns the time of the first and last record of a FIT file, or the
+// first and last trackpoint of a TCX file.
+func Span(data []byte) (start, end time.Time, err error) {
+	var times []time.Time
+	if IsFIT(data) {
+		file, err := fit.Decode(bytes.NewReader(data))
+		if err != nil {
+			return start, end, fmt.Errorf("failed to decode fit file: %v", err)
+		}
+		activity, err := file.Activity()
+		if err != nil {
+			return start, end, fmt.Errorf("not an activity file: %v", err)
+		}
+		for _, r := range activity.Records {
+			times = append(times, r.Timestamp)
+		}
+	} else {
+		doc, err := ParseTCX(data)
+		if err != nil {
+			return start, end, err
+		}
+		for _, a := range doc.Activities {
+			for _, l := range a.Laps {
+				for _, tp := range l.Trackpoints {
+					if t, err := time.Parse(time.RFC3339, tp.Time); err == nil {
+						times = append(times, t)
+					}
+				}
+			}
+		}
+	}
+	if len(times) == 0 {
+		return start, end, fmt.Errorf("file has no records")
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times[0], times[len(times)-1], nil
+}
+
+// SportName returns an activity name for the sport of a FIT or TCX file,
+// such as "Spinning" or "Running", for picking sport defaults as for a
+// Fitbit activity of that name. It is "Workout" if the sport is unknown.
+func SportName(data []byte) string {
+	if !IsFIT(data) {
+		doc, err := ParseTCX(data)
+		if err != nil || len(doc.Activities) == 0 {
+			return "Workout"
+		}
+		switch doc.Activities[0].Sport {
+		case "Running":
+			return "Running"
+		case "Biking":
+			return "Cycling"
+		}
+		return "Workout"
+	}
+
+	file, err := fit.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "Workout"
+	}
+	activity, err := file.Activity()
+	if err != nil || len(activity.Sessions) == 0 {
+		return "Workout"
+	}
+	s := activity.Sessions[0]
+	switch {
+	case s.Sport == fit.SportCycling && s.SubSport == fit.SubSportSpin:
+		return "Spinning"
+	case s.Sport == fit.SportCycling:
+		return "Cycling"
+	case s.Sport == fit.SportRunning:
+		return "Running"
+	case s.Sport == fit.SportWalking, s.Sport == fit.SportHiking:
+		return "Walking"
+	case s.SubSport == fit.SubSportYoga:
+		return "Yoga"
+	case s.SubSport == fit.SubSportStrengthTraining:
+		return "Weight Training"
+	case s.SubSport == fit.SubSportElliptical:
+		return "Elliptical"
+	}
+	return "Workout"
+}
+
+// MergeFIT writes heart rate from samples into the records of a FIT activity
+// file and recomputes the lap and session heart rate stats. Records that
+// already have a heart rate keep it. It returns the merged file and the
+// number of records that were given a heart rate.
+//
+// The file is decoded and written anew, so only what the fit package reads
+// from an activity file is kept: the file id and creator, and the device
+// info, event, record, length, lap, HRV, session and activity messages.
+// Everything else is dropped, such as sport, user profile, workout, zone
+// and timestamp correlation messages, developer data, and fields the FIT
+// profile doesn't define.
+func MergeFIT(data []byte, samples []Sample) ([]byte, int, error) {
+	file, err := fit.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode fit file: %v", err)
+	}
+	activity, err := file.Activity()
+	if err != nil {
+		return nil, 0, fmt.Errorf("not an activity file: %v", err)
+	}
+
+	lookup := heartRateLookup(samples)
+	merged := 0
+	for _, r := range activity.Records {
+		if r.HeartRate != 0xFF && r.HeartRate != 0 {
+			continue
+		}
+		if hr, ok := lookup(r.Timestamp); ok {
+			r.HeartRate = hr
+			merged++
+		}
+	}
+
+	for _, l := range activity.Laps {
+		l.AvgHeartRate, l.MaxHeartRate, l.MinHeartRate = recordHeartRate(activity.Records, l.StartTime, l.Timestamp)
+	}
+	for _, s := range activity.Sessions {
+		s.AvgHeartRate, s.MaxHeartRate, s.MinHeartRate = recordHeartRate(activity.Records, s.StartTime, s.Timestamp)
+	}
+
+	var buf bytes.Buffer
+	if err := writeActivityFile(&buf, file, activity); err != nil {
+		return nil, 0, err
+	}
+	if err := Validate(buf.Bytes()); err != nil {
+		return nil, 0, fmt.Errorf("self-check failed: %w", err)
+	}
+	return buf.Bytes(), merged, nil
+}
+
+// recordHeartRate returns the heart rate stats of the records in
+// [start, end], or invalid values if none have a heart rate.
+func recordHeartRate(records []*fit.RecordMsg, start, end time.Time) (avg, maxHR, minHR uint8) {
+	var hr []Sample
+	for _, r := range records {
+		if r.HeartRate == 0xFF || r.HeartRate == 0 || r.Timestamp.Before(start) || r.Timestamp.After(end) {
+			continue
+		}
+		hr = append(hr, Sample{HeartRate: r.HeartRate})
+	}
+	if len(hr) == 0 {
+		return 0xFF, 0xFF, 0xFF
+	}
+	return heartRateStats(hr)
+}
+
+// writeActivityFile re-encodes a decoded activity in time order: device
+// info, then records, events and laps interleaved by timestamp, then
+// sessions and the activity.
+func writeActivityFile(out io.Writer, src *fit.File, activity *fit.ActivityFile) error {
+	dst, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, true))
+	if err != nil {
+		return fmt.Errorf("failed to create fit file: %v", err)
+	}
+	dst.FileId = src.FileId
+	dst.FileCreator = src.FileCreator
+
+	b, err := newFitBuilder(dst)
+	if err != nil {
+		return err
+	}
+	if len(activity.DeviceInfos) > 0 {
+		if err := b.add(func(a *fit.ActivityFile) { a.DeviceInfos = activity.DeviceInfos }); err != nil {
+			return err
+		}
+	}
+
+	// At equal timestamps events come first and laps last, as devices
+	// write them.
+	type item struct {
+		t     time.Time
+		order int
+		add   func(*fit.ActivityFile)
+	}
+	var items []item
+	for _, e := range activity.Events {
+		items = append(items, item{e.Timestamp, 0, func(a *fit.ActivityFile) { a.Events = append(a.Events, e) }})
+	}
+	for _, r := range activity.Records {
+		items = append(items, item{r.Timestamp, 1, func(a *fit.ActivityFile) { a.Records = append(a.Records, r) }})
+	}
+	for _, l := range activity.Lengths {
+		items = append(items, item{l.Timestamp, 2, func(a *fit.ActivityFile) { a.Lengths = append(a.Lengths, l) }})
+	}
+	for _, l := range activity.Laps {
+		items = append(items, item{l.Timestamp, 3, func(a *fit.ActivityFile) { a.Laps = append(a.Laps, l) }})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].t.Equal(items[j].t) {
+			return items[i].t.Before(items[j].t)
+		}
+		return items[i].order < items[j].order
+	})
+
+	// Consecutive messages of the same type share one definition.
+	for i := 0; i < len(items); {
+		j := i + 1
+		for j < len(items) && items[j].order == items[i].order {
+			j++
+		}
+		run := items[i:j]
+		if err := b.add(func(a *fit.ActivityFile) {
+			for _, it := range run {
+				it.add(a)
+			}
+		}); err != nil {
+			return err
+		}
+		i = j
+	}
+
+	if err := b.add(func(a *fit.ActivityFile) {
+		a.Hrvs = activity.Hrvs
+		a.Sessions = activity.Sessions
+	}); err != nil {
+		return err
+	}
+	if activity.Activity != nil {
+		if err := b.add(func(a *fit.ActivityFile) { a.Activity = activity.Activity }); err != nil {
+			return err
+		}
+	}
+
+	return b.writeTo(out)
+}
@@ -0,0 +1,194 @@
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// deviceFile encodes a trainer app's activity file: one record per entry of
+// times, with power but no heart rate, in one lap and session.
+func deviceFile(t *testing.T, times []time.Time) []byte {
+	t.Helper()
+	file, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.FileId.Manufacturer = fit.ManufacturerZwift
+	file.FileId.TimeCreated = times[0]
+	activity, err := file.Activity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range times {
+		rec := fit.NewRecordMsg()
+		rec.Timestamp = at
+		rec.Power = 200
+		activity.Records = append(activity.Records, rec)
+	}
+	start, end := times[0], times[len(times)-1]
+	elapsed := uint32(end.Sub(start).Milliseconds())
+
+	lap := fit.NewLapMsg()
+	lap.StartTime, lap.Timestamp, lap.TotalElapsedTime = start, end, elapsed
+	activity.Laps = []*fit.LapMsg{lap}
+
+	session := fit.NewSessionMsg()
+	session.Sport, session.SubSport = fit.SportCycling, fit.SubSportVirtualActivity
+	session.StartTime, session.Timestamp, session.TotalElapsedTime = start, end, elapsed
+	session.NumLaps = 1
+	activity.Sessions = []*fit.SessionMsg{session}
+
+	activity.Activity = fit.NewActivityMsg()
+	activity.Activity.Timestamp = end
+	activity.Activity.NumSessions = 1
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// everySecond returns n times a second apart from lapStart, each repeated
+// perSecond times.
+func everySecond(n, perSecond int) []time.Time {
+	var times []time.Time
+	for i := range n {
+		for range perSecond {
+			times = append(times, lapStart.Add(time.Duration(i)*time.Second))
+		}
+	}
+	return times
+}
+
+func mergedReport(t *testing.T, merged []byte) *Report {
+	t.Helper()
+	report, err := Inspect(bytes.NewReader(merged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestMergeFIT(t *testing.T) {
+	data := deviceFile(t, everySecond(300, 1))
+	samples := secondSamples(-10, 310, func(i int) uint8 { return uint8(120 + i/10) })
+
+	merged, count, err := MergeFIT(data, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 300 {
+		t.Errorf("merged %d records, want 300", count)
+	}
+	report := mergedReport(t, merged)
+	if report.Records != 300 || report.FileID.Manufacturer != fit.ManufacturerZwift {
+		t.Errorf("%d records from %v, want the file's 300 from Zwift", report.Records, report.FileID.Manufacturer)
+	}
+	s := report.Sessions[0]
+	if s.MinHeartRate != 120 || s.MaxHeartRate != 149 || s.AvgHeartRate == 0xFF {
+		t.Errorf("session heart rate avg %d, max %d, min %d; want 120 to 149", s.AvgHeartRate, s.MaxHeartRate, s.MinHeartRate)
+	}
+	if l := report.Laps[0]; l.MaxHeartRate != 149 {
+		t.Errorf("lap max heart rate %d, want 149", l.MaxHeartRate)
+	}
+	if s.Sport != fit.SportCycling || s.SubSport != fit.SubSportVirtualActivity {
+		t.Errorf("sport %v/%v, want the file's", s.Sport, s.SubSport)
+	}
+}
+
+func TestMergeFITDuplicateTimestamps(t *testing.T) {
+	data := deviceFile(t, everySecond(120, 2))
+	merged, count, err := MergeFIT(data, secondSamples(0, 120, steadyHR))
+	if err != nil {
+		t.Fatalf("MergeFIT rejected two records a second: %v", err)
+	}
+	if count != 240 {
+		t.Errorf("merged %d records, want 240", count)
+	}
+	if report := mergedReport(t, merged); report.Records != 240 {
+		t.Errorf("%d records, want 240", report.Records)
+	}
+}
+
+func TestMergeFITWithoutOverlap(t *testing.T) {
+	data := deviceFile(t, everySecond(120, 1))
+	// Fitbit's heart rate is from an hour later.
+	samples := secondSamples(3600, 3720, steadyHR)
+	merged, count, err := MergeFIT(data, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("merged %d records, want none", count)
+	}
+	if s := mergedReport(t, merged).Sessions[0]; s.AvgHeartRate != 0xFF {
+		t.Errorf("session average heart rate %d without any heart rate", s.AvgHeartRate)
+	}
+}
+
+func TestEnrichTCXCount(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, gpxWorkout(true), Options{Format: FormatTCX}); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the heart rate the encoder wrote.
+	doc, err := ParseTCX(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for l := range doc.Activities[0].Laps {
+		for p := range doc.Activities[0].Laps[l].Trackpoints {
+			doc.Activities[0].Laps[l].Trackpoints[p].HeartRate = nil
+		}
+	}
+	data, err := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fitbit only has the first minute; trackpoints up to MaxMatchOffset
+	// after it still match the last sample, the rest stay without.
+	samples := gpxWorkout(true).Samples[:60]
+	want := 60 + int(MaxMatchOffset/time.Second)
+	if _, count, err := EnrichTCX(data, samples); err != nil || count != want {
+		t.Errorf("EnrichTCX = %d, %v; want %d trackpoints", count, err, want)
+	}
+	if _, count, _ := EnrichTCX(data, nil); count != 0 {
+		t.Errorf("EnrichTCX without samples = %d, want 0", count)
+	}
+}
+
+func TestSportName(t *testing.T) {
+	var spin bytes.Buffer
+	if err := Encode(&spin, spinWorkout(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var ride bytes.Buffer
+	wk := gpxWorkout(true)
+	wk.Name = "Bike"
+	if err := Encode(&ride, wk, Options{Format: FormatTCX}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{spin.Bytes(), "Spinning"},
+		{deviceFile(t, everySecond(10, 1)), "Cycling"},
+		{ride.Bytes(), "Cycling"},
+		{[]byte("not a file"), "Workout"},
+	}
+	for i, tt := range tests {
+		if got := SportName(tt.data); got != tt.want {
+			t.Errorf("file %d: SportName = %q, want %q", i, got, tt.want)
+		}
+	}
+}
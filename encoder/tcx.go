@@ -0,0 +1,246 @@
+package encoder
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+const tcxNamespace = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+
+// TCX document types. Only the elements Fitbit and Strava use are modelled;
+// anything else is dropped when a parsed document is written back, except
+// Extensions (power, speed), which are kept verbatim along with the
+// namespaces they use.
+type TCX struct {
+	XMLName    xml.Name      `xml:"TrainingCenterDatabase"`
+	Xmlns      string        `xml:"xmlns,attr,omitempty"`
+	XmlnsXsi   string        `xml:"xmlns:xsi,attr,omitempty"`
+	Namespaces []xml.Attr    `xml:",any,attr"`
+	Activities []TCXActivity `xml:"Activities>Activity"`
+}
+
+type TCXActivity struct {
+	Sport   string     `xml:"Sport,attr"`
+	ID      string     `xml:"Id"`
+	Laps    []TCXLap   `xml:"Lap"`
+	Creator *TCXDevice `xml:"Creator,omitempty"`
+}
+
+type TCXLap struct {
+	StartTime        string         `xml:"StartTime,attr"`
+	TotalTimeSeconds float64        `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64        `xml:"DistanceMeters"`
+	Calories         int            `xml:"Calories"`
+	AverageHeartRate *TCXHeartRate  `xml:"AverageHeartRateBpm,omitempty"`
+	MaximumHeartRate *TCXHeartRate  `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity        string         `xml:"Intensity"`
+	TriggerMethod    string         `xml:"TriggerMethod"`
+	Trackpoints      []Trackpoint   `xml:"Track>Trackpoint"`
+	Extensions       *TCXExtensions `xml:"Extensions,omitempty"`
+}
+
+type Trackpoint struct {
+	Time           string         `xml:"Time"`
+	Position       *TCXPosition   `xml:"Position,omitempty"`
+	AltitudeMeters *float64       `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters *float64       `xml:"DistanceMeters,omitempty"`
+	HeartRate      *TCXHeartRate  `xml:"HeartRateBpm,omitempty"`
+	Cadence        *int           `xml:"Cadence,omitempty"`
+	Extensions     *TCXExtensions `xml:"Extensions,omitempty"`
+}
+
+// TCXExtensions holds an Extensions element's raw content.
+type TCXExtensions struct {
+	InnerXML string `xml:",innerxml"`
+}
+
+type TCXPosition struct {
+	LatitudeDegrees  float64 `xml:"LatitudeDegrees"`
+	LongitudeDegrees float64 `xml:"LongitudeDegrees"`
+}
+
+type TCXHeartRate struct {
+	Value int `xml:"Value"`
+}
+
+type TCXDevice struct {
+	Type      string      `xml:"xsi:type,attr,omitempty"`
+	Name      string      `xml:"Name"`
+	UnitID    uint32      `xml:"UnitId"`
+	ProductID uint16      `xml:"ProductID"`
+	Version   *TCXVersion `xml:"Version,omitempty"`
+}
+
+// TCXVersion is a software version, e.g. 26.10 as major 26, minor 10.
+type TCXVersion struct {
+	VersionMajor int `xml:"VersionMajor"`
+	VersionMinor int `xml:"VersionMinor"`
+}
+
+// ParseTCX decodes a TCX document.
+func ParseTCX(data []byte) (*TCX, error) {
+	var doc TCX
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse tcx: %v", err)
+	}
+	return &doc, nil
+}
+
+// Marshal encodes the document with the TCX namespace and XML header.
+func (t *TCX) Marshal() ([]byte, error) {
+	t.Xmlns = tcxNamespace
+	t.XmlnsXsi = ""
+	// encoding/xml reads prefix declarations as attributes in the "xmlns"
+	// space but can't write them back that way; keep them as plain names.
+	namespaces := t.Namespaces[:0]
+	for _, a := range t.Namespaces {
+		switch {
+		case a.Name.Space == "xmlns" && a.Name.Local != "xsi":
+			namespaces = append(namespaces, xml.Attr{Name: xml.Name{Local: "xmlns:" + a.Name.Local}, Value: a.Value})
+		case a.Name.Space == "" && a.Name.Local != "xmlns":
+			namespaces = append(namespaces, a)
+		}
+	}
+	t.Namespaces = namespaces
+	for i := range t.Activities {
+		// Creator must be typed as a device to validate against the schema.
+		if c := t.Activities[i].Creator; c != nil {
+			c.Type = "Device_t"
+			t.XmlnsXsi = "http://www.w3.org/2001/XMLSchema-instance"
+		}
+	}
+	out, err := xml.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tcx: %v", err)
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// EnrichTCX fills trackpoint heart rate from 1-second samples and
+// recomputes each lap's average and maximum heart rate. Trackpoints that
+// already have a heart rate keep it. Samples are matched to the nearest
+// second within a few seconds of the trackpoint. It returns the enriched
+// document and the number of trackpoints that were given a heart rate.
+func EnrichTCX(data []byte, samples []Sample) ([]byte, int, error) {
+	doc, err := ParseTCX(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lookup := heartRateLookup(samples)
+	merged := 0
+
+	for a := range doc.Activities {
+		for l := range doc.Activities[a].Laps {
+			lap := &doc.Activities[a].Laps[l]
+			var sum, count, maxHR int
+			for p := range lap.Trackpoints {
+				tp := &lap.Trackpoints[p]
+				if tp.HeartRate == nil {
+					t, err := time.Parse(time.RFC3339, tp.Time)
+					if err != nil {
+						continue
+					}
+					if v, ok := lookup(t); ok {
+						tp.HeartRate = &TCXHeartRate{Value: int(v)}
+						merged++
+					}
+				}
+				if tp.HeartRate != nil {
+					sum += tp.HeartRate.Value
+					count++
+					maxHR = max(maxHR, tp.HeartRate.Value)
+				}
+			}
+			if count > 0 {
+				lap.AverageHeartRate = &TCXHeartRate{Value: sum / count}
+				lap.MaximumHeartRate = &TCXHeartRate{Value: maxHR}
+			}
+		}
+	}
+
+	out, err := doc.Marshal()
+	return out, merged, err
+}
+
+// writeTCX encodes the workout as a TCX activity with one Lap element per lap.
+func writeTCX(out io.Writer, w *workout) error {
+	sport := "Other"
+	switch w.sport {
+	case fit.SportRunning:
+		sport = "Running"
+	case fit.SportCycling:
+		sport = "Biking"
+	}
+
+	act := TCXActivity{
+		Sport: sport,
+		ID:    w.startTime().Format(time.RFC3339),
+	}
+	if w.device.Name != "" {
+		// The same hundredths the FIT device info carries, which the
+		// schema requires even when unknown.
+		v := int(math.Round(w.device.SoftwareVersion * 100))
+		act.Creator = &TCXDevice{
+			Name:      w.device.Name,
+			UnitID:    w.device.SerialNumber,
+			ProductID: w.device.Product,
+			Version:   &TCXVersion{VersionMajor: v / 100, VersionMinor: v % 100},
+		}
+	}
+
+	for _, l := range w.laps {
+		tl := TCXLap{
+			StartTime:        l.startTime.Format(time.RFC3339),
+			TotalTimeSeconds: l.endTime.Sub(l.startTime).Seconds(),
+			DistanceMeters:   l.distance,
+			Calories:         l.calories,
+			AverageHeartRate: &TCXHeartRate{Value: int(l.avgHR)},
+			MaximumHeartRate: &TCXHeartRate{Value: int(l.maxHR)},
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+		}
+		if l.intensity == fit.IntensityRest {
+			tl.Intensity = "Resting"
+		}
+		if l.trigger == fit.LapTriggerTime {
+			tl.TriggerMethod = "Time"
+		}
+
+		for _, s := range w.samples[l.start:l.end] {
+			tp := Trackpoint{
+				Time:      s.Time.Format(time.RFC3339),
+				HeartRate: &TCXHeartRate{Value: int(s.HeartRate)},
+			}
+			if s.hasPosition() {
+				tp.Position = &TCXPosition{LatitudeDegrees: s.Latitude, LongitudeDegrees: s.Longitude}
+			}
+			if w.hasDistance {
+				d := s.Distance
+				tp.DistanceMeters = &d
+			}
+			if w.hasCadence {
+				c := int(s.Cadence / 2)
+				tp.Cadence = &c
+			}
+			tl.Trackpoints = append(tl.Trackpoints, tp)
+		}
+
+		act.Laps = append(act.Laps, tl)
+	}
+
+	doc := &TCX{Activities: []TCXActivity{act}}
+	data, err := doc.Marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed to write tcx: %v", err)
+	}
+	return nil
+}
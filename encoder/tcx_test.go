@@ -0,0 +1,26 @@
+package encoder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTCXCreatorVersion(t *testing.T) {
+	wk := gpxWorkout(false)
+	wk.Device = Device{Name: "Charge 6", SerialNumber: 1234, SoftwareVersion: 26.10}
+	var buf bytes.Buffer
+	if err := Encode(&buf, wk, Options{Format: FormatTCX}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseTCX(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := doc.Activities[0].Creator
+	if c == nil || c.Version == nil {
+		t.Fatalf("Creator = %+v, want a Version", c)
+	}
+	if *c.Version != (TCXVersion{VersionMajor: 26, VersionMinor: 10}) {
+		t.Errorf("Version = %+v, want 26.10", *c.Version)
+	}
+}
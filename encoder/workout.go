@@ -0,0 +1,251 @@
+package encoder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// Workout is a source-neutral activity. Sources fill in what they have; the
+// encoder derives laps, calories and summary stats for the rest.
+type Workout struct {
+	// Name is the activity name, e.g. "Spinning". It selects the sport.
+	Name   string
+	Device Device
+
+	// Samples must be in time order. Zero values for the optional fields
+	// (distance, cadence, calories) mean the source doesn't have them.
+	Samples []Sample
+	// Laps are optional; when empty they are derived from Options.Laps.
+	Laps []Lap
+	// Events are timer start/stop events, e.g. for pauses. Optional.
+	Events []Event
+
+	// Calories is the total kcal, or zero if unknown.
+	Calories int
+	// Steps is the total step count, or zero if unknown.
+	Steps int
+}
+
+// Device identifies the recording device. Zero values are omitted; a zero
+// Manufacturer is written as the FIT "development" manufacturer.
+type Device struct {
+	Name            string
+	Manufacturer    fit.Manufacturer
+	Product         uint16
+	SerialNumber    uint32
+	SoftwareVersion float64 // e.g. 1.23
+	Battery         fit.BatteryStatus
+}
+
+// Sample is a single point in time, typically one second apart.
+type Sample struct {
+	Time      time.Time
+	HeartRate uint8
+	Distance  float64 // metres since the start
+	Speed     float64 // metres per second
+	Cadence   float64 // steps per minute
+	Calories  float64 // accumulated kcal
+	// Latitude and Longitude are in degrees; both zero means no fix.
+	Latitude, Longitude float64
+}
+
+// hasPosition reports whether the sample has a position fix.
+func (s Sample) hasPosition() bool { return s.Latitude != 0 || s.Longitude != 0 }
+
+// Lap is a source-provided lap boundary. Stats are computed by the encoder.
+type Lap struct {
+	Start, End time.Time
+	Rest       bool
+}
+
+// EventType is the kind of timer event.
+type EventType int
+
+const (
+	EventStart EventType = iota
+	EventStop
+)
+
+// Event is a timer start or stop.
+type Event struct {
+	Time time.Time
+	Type EventType
+}
+
+// workout is the prepared form of a Workout shared by the FIT, TCX and GPX
+// writers.
+type workout struct {
+	sport     fit.Sport
+	subSport  fit.SubSport
+	sportName string
+	device    Device
+
+	samples []Sample
+	laps    []lap
+	events  []Event
+
+	// Which optional sample fields are populated.
+	hasDistance bool
+	hasCadence  bool
+	hasCalories bool
+	hasPosition bool
+
+	calories   int
+	totalSteps float64
+}
+
+// lap covers samples [start, end). It ends where the next lap starts, so
+// laps tile the session.
+type lap struct {
+	start, end         int
+	startTime, endTime time.Time
+	intensity          fit.Intensity
+	trigger            fit.LapTrigger
+
+	avgHR, maxHR uint8
+	distance     float64 // metres
+	calories     int
+}
+
+// sampleDuration is how long each sample covers. The session ends one
+// sample after the last one so 600 one-second samples make a 10 minute
+// session.
+const sampleDuration = time.Second
+
+func (w *workout) startTime() time.Time { return w.samples[0].Time }
+func (w *workout) endTime() time.Time {
+	return w.samples[len(w.samples)-1].Time.Add(sampleDuration)
+}
+func (w *workout) duration() time.Duration {
+	return w.endTime().Sub(w.startTime())
+}
+
+// timeAt returns the start of sample i, or the session end for i == len(samples).
+func (w *workout) timeAt(i int) time.Time {
+	if i >= len(w.samples) {
+		return w.endTime()
+	}
+	return w.samples[i].Time
+}
+
+// timerTime returns the time between from and to during which the timer was
+// running, i.e. excluding pauses marked by stop/start events.
+func (w *workout) timerTime(from, to time.Time) time.Duration {
+	var total time.Duration
+	running, since := true, from
+	for _, e := range w.events {
+		if !e.Time.After(from) {
+			running = e.Type == EventStart
+			continue
+		}
+		if !e.Time.Before(to) {
+			break
+		}
+		switch {
+		case running && e.Type == EventStop:
+			total += e.Time.Sub(since)
+			running = false
+		case !running && e.Type == EventStart:
+			since = e.Time
+			running = true
+		}
+	}
+	if running {
+		total += to.Sub(since)
+	}
+	return total
+}
+
+func (w *workout) distance() float64 {
+	if !w.hasDistance {
+		return 0
+	}
+	return w.samples[len(w.samples)-1].Distance
+}
+
+// heartRateStats returns the average, maximum and minimum HR of samples.
+func heartRateStats(samples []Sample) (avg, maxHR, minHR uint8) {
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	var total uint64
+	minHR = 255
+	for _, s := range samples {
+		total += uint64(s.HeartRate)
+		maxHR = max(maxHR, s.HeartRate)
+		minHR = min(minHR, s.HeartRate)
+	}
+	return uint8(total / uint64(len(samples))), maxHR, minHR
+}
+
+// ErrNoPosition is returned for GPX output of a workout without positions,
+// such as one built from heart rate alone.
+var ErrNoPosition = errors.New("gpx needs position data, which this workout doesn't have; use -format fit or tcx")
+
+// prepare validates the workout and derives everything the writers need:
+// sport, calories, laps and which optional fields are present. The caller's
+// samples are not modified.
+func prepare(wk Workout, opts Options) (*workout, error) {
+	if len(wk.Samples) == 0 {
+		return nil, fmt.Errorf("no heart rate samples")
+	}
+
+	w := &workout{
+		device:     wk.Device,
+		samples:    append([]Sample(nil), wk.Samples...),
+		events:     append([]Event(nil), wk.Events...),
+		totalSteps: float64(wk.Steps),
+	}
+	sort.SliceStable(w.events, func(i, j int) bool { return w.events[i].Time.Before(w.events[j].Time) })
+	w.sport, w.subSport, w.sportName = sportFor(wk.Name)
+
+	last := w.samples[len(w.samples)-1]
+	w.hasDistance = last.Distance > 0
+	for _, s := range w.samples {
+		w.hasCadence = w.hasCadence || s.Cadence > 0
+		w.hasPosition = w.hasPosition || s.hasPosition()
+	}
+	// GPX requires a position on every track point.
+	if opts.Format == FormatGPX && !w.hasPosition {
+		return nil, ErrNoPosition
+	}
+
+	applyCalories(w, wk.Calories, last.Calories > 0, opts.Profile)
+
+	if len(wk.Laps) > 0 {
+		w.laps = sourceLaps(w, wk.Laps)
+	} else {
+		// Always write at least one lap; many tools reject activities without one.
+		w.laps = buildLaps(w, opts.Laps)
+	}
+
+	return w, nil
+}
+
+// sourceLaps maps source-provided lap boundaries onto sample ranges.
+func sourceLaps(w *workout, laps []Lap) []lap {
+	var splits []lapSplit
+	for _, l := range laps {
+		start := sort.Search(len(w.samples), func(i int) bool { return !w.samples[i].Time.Before(l.Start) })
+		end := sort.Search(len(w.samples), func(i int) bool { return !w.samples[i].Time.Before(l.End) })
+		if start >= end {
+			continue
+		}
+		intensity := fit.IntensityActive
+		if l.Rest {
+			intensity = fit.IntensityRest
+		}
+		splits = append(splits, lapSplit{start: start, end: end, intensity: intensity, trigger: fit.LapTriggerManual})
+	}
+	if len(splits) == 0 {
+		return buildLaps(w, LapOptions{})
+	}
+	// Laps tile the session: stretch the last lap to the final sample.
+	splits[len(splits)-1].end = len(w.samples)
+	splits[len(splits)-1].trigger = fit.LapTriggerSessionEnd
+	return lapsFromSplits(w, splits)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/pipeline"
+)
+
+// runExport implements `fitbit-strava export`: build the activity file for
+// a Fitbit activity or time range and write it to disk.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	logID := fs.Int64("log-id", 0, "Fitbit activity to export (see `fitbit-strava list`)")
+	window := newWindowFlags(fs)
+	encode := newEncodeFlags(fs)
+	gps := newGPSFlags(fs)
+	out := fs.String("out", "", "Output file (default fitbit-<log id>.<format>, or workout.<format>)")
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava export [-log-id id | -start HH:mm [-date YYYY-MM-DD] [-duration min]] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*logID == 0) == !window.set() {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	opts, err := encode.options()
+	if err != nil {
+		return report.fail(err)
+	}
+
+	p := setupFitbit()
+
+	var selected *fitbit.ActivityLog
+	var win pipeline.Window
+	if *logID != 0 {
+		if selected, err = findActivity(p, *logID); err == nil {
+			win, err = pipeline.WindowFor(*selected)
+		}
+	} else {
+		win, err = window.window()
+	}
+	res := activityResult{LogID: *logID, StartTime: win.Start}
+	if err != nil {
+		return report.failActivity(res, err)
+	}
+
+	act, err := buildActivity(p, selected, win, opts, gps)
+	if err != nil {
+		return report.failActivity(res, err)
+	}
+	res.Name = act.Name
+
+	filename := *out
+	if filename == "" {
+		filename = "workout." + act.Format
+		if selected != nil {
+			filename = fmt.Sprintf("fitbit-%d.%s", selected.LogID, act.Format)
+		}
+	}
+	res.File = filename
+	if err := os.WriteFile(filename, act.Data, 0644); err != nil {
+		return report.failActivity(res, fmt.Errorf("failed to write file: %v", err))
+	}
+	report.textf("File saved to %s\n", filename)
+	if act.Format == string(encoder.FormatFIT) {
+		report.textf("Run `fitbit-strava inspect %s` to check it.\n", filename)
+	}
+	res.Status = statusSaved
+	report.add(res)
+	return report.finish()
+}
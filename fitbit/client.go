@@ -10,13 +10,49 @@ import (
 
 type HeartRateResponse struct {
 	ActivitiesHeartIntraday struct {
-		Dataset []struct {
-			Time  string  `json:"time"`
-			Value float64 `json:"value"`
-		} `json:"dataset"`
+		Dataset []IntradayPoint `json:"dataset"`
 	} `json:"activities-heart-intraday"`
 }
 
+// IntradayPoint is a single sample of an intraday series. Time is the
+// local time of day, HH:mm:ss.
+type IntradayPoint struct {
+	Time  string  `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// IntradaySeries is a minute-level intraday series such as steps or distance.
+type IntradaySeries struct {
+	Dataset         []IntradayPoint `json:"dataset"`
+	DatasetInterval int             `json:"datasetInterval"`
+	DatasetType     string          `json:"datasetType"`
+}
+
+// Profile holds the user attributes needed for calorie estimation.
+// Weight is in kilograms when no Accept-Language header is sent.
+type Profile struct {
+	Age    int     `json:"age"`
+	Gender string  `json:"gender"` // MALE, FEMALE or NA
+	Weight float64 `json:"weight"`
+	Height float64 `json:"height"`
+}
+
+type ProfileResponse struct {
+	User Profile `json:"user"`
+}
+
+// Device is a paired tracker or scale from devices.json. Fitbit does not
+// report firmware versions; DeviceVersion is the model name, e.g. "Charge 6".
+type Device struct {
+	ID            string `json:"id"`
+	DeviceVersion string `json:"deviceVersion"`
+	Type          string `json:"type"`    // TRACKER or SCALE
+	Battery       string `json:"battery"` // High, Medium, Low or Empty
+	BatteryLevel  int    `json:"batteryLevel"`
+	LastSyncTime  string `json:"lastSyncTime"`
+	MAC           string `json:"mac"`
+}
+
 type ActivityLogSource struct {
 	Type            string   `json:"type"`
 	Name            string   `json:"name"`
@@ -39,6 +75,28 @@ type ActivityLogsResponse struct {
 	Activities []ActivityLog `json:"activities"`
 }
 
+// APIError is an unsuccessful response from the Fitbit API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("fitbit api error: status %s, body: %s", e.Status, e.Body)
+}
+
+// RateLimited reports whether the hourly request limit was reached.
+func (e *APIError) RateLimited() bool { return e.StatusCode == http.StatusTooManyRequests }
+
+// Unauthorized reports whether the token was rejected.
+func (e *APIError) Unauthorized() bool { return e.StatusCode == http.StatusUnauthorized }
+
 type Client struct {
 	HttpClient *http.Client
 }
@@ -53,12 +111,12 @@ func (c *Client) FetchIntradayHeartRate(date, startTime, endTime string) (*Heart
 
 	resp, err := c.HttpClient.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data: %v", err)
+		return nil, fmt.Errorf("failed to fetch data: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fitbit api error: status %s", resp.Status)
+		return nil, newAPIError(resp)
 	}
 
 	var hrData HeartRateResponse
@@ -70,25 +128,28 @@ func (c *Client) FetchIntradayHeartRate(date, startTime, endTime string) (*Heart
 }
 
 func (c *Client) GetRecentActivities(limit int) (*ActivityLogsResponse, error) {
-	// API requires exactly one of beforeDate or afterDate.
-	// We use beforeDate=<tomorrow> to capture all recent activities including today's.
-	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	// Tomorrow, to include today's activities.
+	return c.GetActivitiesBefore(time.Now().AddDate(0, 0, 1).Format("2006-01-02"), limit)
+}
+
+// GetActivitiesBefore returns up to limit (at most 100) activities that
+// started before before, newest first. before is a date (2006-01-02) or a
+// local date and time (2006-01-02T15:04:05); passing the start time of the
+// oldest activity of one call pages back to the next.
+func (c *Client) GetActivitiesBefore(before string, limit int) (*ActivityLogsResponse, error) {
+	// The API requires exactly one of beforeDate or afterDate, and the
+	// offset is only for paging within the same one.
 	url := fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/list.json?beforeDate=%s&sort=desc&offset=0&limit=%d",
-		tomorrow, limit)
-	// actually, the list endpoint is a bit tricky with afterDate/beforeDate for "recent".
-	// Try the standard generic list endpoint or just use the activity log endpoint if it supports pagination?
-	// https://dev.fitbit.com/build/reference/web-api/activity/get-activity-log-list/
-	// GET https://api.fitbit.com/1/user/[user-id]/activities/list.json
+		before, limit)
 
 	resp, err := c.HttpClient.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch recent activities: %v", err)
+		return nil, fmt.Errorf("failed to fetch recent activities: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("fitbit api error: status %s, body: %s", resp.Status, string(body))
+		return nil, newAPIError(resp)
 	}
 
 	var logs ActivityLogsResponse
@@ -104,12 +165,12 @@ func (c *Client) GetActivityLogs(date string) (*ActivityLogsResponse, error) {
 
 	resp, err := c.HttpClient.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch activity logs: %v", err)
+		return nil, fmt.Errorf("failed to fetch activity logs: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fitbit api error: status %s", resp.Status)
+		return nil, newAPIError(resp)
 	}
 
 	var logs ActivityLogsResponse
@@ -119,3 +180,112 @@ func (c *Client) GetActivityLogs(date string) (*ActivityLogsResponse, error) {
 
 	return &logs, nil
 }
+
+// FetchIntradaySteps returns the 1-minute step counts between startTime and endTime.
+func (c *Client) FetchIntradaySteps(date, startTime, endTime string) (*IntradaySeries, error) {
+	return c.fetchIntraday("steps", date, startTime, endTime)
+}
+
+// FetchIntradayDistance returns the 1-minute distance in kilometres between
+// startTime and endTime. Fitbit uses metric units when no Accept-Language is sent.
+func (c *Client) FetchIntradayDistance(date, startTime, endTime string) (*IntradaySeries, error) {
+	return c.fetchIntraday("distance", date, startTime, endTime)
+}
+
+// FetchIntradayCalories returns the 1-minute calorie burn between startTime and endTime.
+func (c *Client) FetchIntradayCalories(date, startTime, endTime string) (*IntradaySeries, error) {
+	return c.fetchIntraday("calories", date, startTime, endTime)
+}
+
+// GetProfile returns the user's profile. Requires the "profile" scope.
+func (c *Client) GetProfile() (*Profile, error) {
+	resp, err := c.HttpClient.Get("https://api.fitbit.com/1/user/-/profile.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var profile ProfileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %v", err)
+	}
+
+	return &profile.User, nil
+}
+
+// GetDevices returns the user's paired devices. Requires the "settings" scope.
+func (c *Client) GetDevices() ([]Device, error) {
+	resp, err := c.HttpClient.Get("https://api.fitbit.com/1/user/-/devices.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var devices []Device
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, fmt.Errorf("failed to decode devices: %v", err)
+	}
+
+	return devices, nil
+}
+
+func (c *Client) fetchIntraday(resource, date, startTime, endTime string) (*IntradaySeries, error) {
+	url := fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/%s/date/%s/1d/1min/time/%s/%s.json",
+		resource, date, startTime, endTime)
+
+	resp, err := c.HttpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s data: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	// The series is keyed by resource, e.g. "activities-steps-intraday".
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %v", resource, err)
+	}
+
+	var series IntradaySeries
+	if raw, ok := body["activities-"+resource+"-intraday"]; ok {
+		if err := json.Unmarshal(raw, &series); err != nil {
+			return nil, fmt.Errorf("failed to decode %s series: %v", resource, err)
+		}
+	}
+
+	return &series, nil
+}
+
+// FetchActivityTCX downloads Fitbit's TCX export of a logged activity,
+// including GPS track points. Requires the "location" scope.
+func (c *Client) FetchActivityTCX(logID int64) ([]byte, error) {
+	url := fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/%d.tcx", logID)
+
+	resp, err := c.HttpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tcx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tcx: %v", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,272 @@
+// Package export reads activities and heart rate from a Fitbit data export
+// (Google Takeout or the legacy "Download your data" archive), so workouts
+// older than the API keeps can be backfilled offline.
+//
+// The export contains, somewhere below its root:
+//
+//	exercise-0.json, exercise-100.json, ...   activity logs
+//	heart_rate-YYYY-MM-DD.json                1-5 second heart rate, in UTC
+//
+// Data is returned in the same types the API client uses, and *Export has
+// the API client's methods that pipeline.Fetch needs, so an export can
+// stand in for the API.
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fitbit-strava/fitbit"
+)
+
+// exportTime is the timestamp layout used throughout the export.
+const exportTime = "01/02/06 15:04:05"
+
+// Export is an opened data export.
+type Export struct {
+	fsys   fs.FS
+	closer io.Closer
+	// files maps base names to their path in fsys.
+	files map[string]string
+	// heartRate caches parsed heart rate files by UTC date.
+	heartRate map[string][]sample
+	// activities caches the activity logs once read.
+	activities []fitbit.ActivityLog
+}
+
+type sample struct {
+	time time.Time
+	bpm  float64
+}
+
+// Open opens an unzipped export directory or a .zip archive.
+func Open(name string) (*Export, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export: %v", err)
+	}
+
+	e := &Export{files: map[string]string{}, heartRate: map[string][]sample{}}
+	if info.IsDir() {
+		e.fsys = os.DirFS(name)
+	} else {
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open export archive: %v", err)
+		}
+		e.fsys, e.closer = zr, zr
+	}
+
+	err = fs.WalkDir(e.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".json") {
+			e.files[path.Base(p)] = p
+		}
+		return nil
+	})
+	if err != nil {
+		e.Close()
+		return nil, fmt.Errorf("failed to read export: %v", err)
+	}
+	return e, nil
+}
+
+// Close releases the archive, if any.
+func (e *Export) Close() error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// exercise is an activity log as written to exercise-*.json.
+type exercise struct {
+	LogID        int64                    `json:"logId"`
+	ActivityName string                   `json:"activityName"`
+	Calories     int                      `json:"calories"`
+	Duration     int                      `json:"duration"`  // milliseconds
+	StartTime    string                   `json:"startTime"` // local, exportTime
+	Source       fitbit.ActivityLogSource `json:"source"`
+	HasGPS       bool                     `json:"hasGps"`
+}
+
+// Activities returns every logged activity, oldest first. StartTime is
+// ISO 8601 in the local zone, as returned by the API.
+func (e *Export) Activities() ([]fitbit.ActivityLog, error) {
+	if e.activities != nil {
+		return e.activities, nil
+	}
+	logs := []fitbit.ActivityLog{}
+	for base, p := range e.files {
+		if !strings.HasPrefix(base, "exercise-") {
+			continue
+		}
+		var exercises []exercise
+		if err := e.decode(p, &exercises); err != nil {
+			return nil, err
+		}
+		for _, ex := range exercises {
+			start, err := time.ParseInLocation(exportTime, ex.StartTime, time.Local)
+			if err != nil {
+				continue
+			}
+			logs = append(logs, fitbit.ActivityLog{
+				LogID:     ex.LogID,
+				Name:      ex.ActivityName,
+				Calories:  ex.Calories,
+				Duration:  ex.Duration,
+				StartTime: start.Format("2006-01-02T15:04:05.000-07:00"),
+				Source:    ex.Source,
+				HasGPS:    ex.HasGPS,
+			})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].StartTime < logs[j].StartTime })
+	e.activities = logs
+	return logs, nil
+}
+
+// GetActivityLogs returns the activities that started on date, YYYY-MM-DD
+// in the local zone. Like the API's daily log, StartTime is HH:mm.
+func (e *Export) GetActivityLogs(date string) (*fitbit.ActivityLogsResponse, error) {
+	activities, err := e.Activities()
+	if err != nil {
+		return nil, err
+	}
+	var resp fitbit.ActivityLogsResponse
+	for _, act := range activities {
+		start, err := time.Parse("2006-01-02T15:04:05.000-07:00", act.StartTime)
+		if err != nil || start.Local().Format("2006-01-02") != date {
+			continue
+		}
+		act.StartTime = start.Local().Format("15:04")
+		resp.Activities = append(resp.Activities, act)
+	}
+	return &resp, nil
+}
+
+// FetchIntradaySteps returns an empty series: the export's minute-level
+// steps aren't read.
+func (e *Export) FetchIntradaySteps(date, startTime, endTime string) (*fitbit.IntradaySeries, error) {
+	return &fitbit.IntradaySeries{}, nil
+}
+
+// FetchIntradayDistance returns an empty series: the export's minute-level
+// distance isn't read.
+func (e *Export) FetchIntradayDistance(date, startTime, endTime string) (*fitbit.IntradaySeries, error) {
+	return &fitbit.IntradaySeries{}, nil
+}
+
+// FetchIntradayCalories returns an empty series: the export's minute-level
+// calories aren't read.
+func (e *Export) FetchIntradayCalories(date, startTime, endTime string) (*fitbit.IntradaySeries, error) {
+	return &fitbit.IntradaySeries{}, nil
+}
+
+// GetProfile fails: the profile isn't read from the export, so calories
+// aren't estimated for activities logged without them.
+func (e *Export) GetProfile() (*fitbit.Profile, error) {
+	return nil, errors.New("the profile isn't read from a data export")
+}
+
+// GetDevices returns no devices. The export describes devices only as the
+// source of each activity.
+func (e *Export) GetDevices() ([]fitbit.Device, error) {
+	return nil, nil
+}
+
+// FetchIntradayHeartRate returns the heart rate for date between startTime
+// and endTime (HH:mm, local time), like the API client's method of the same
+// name. Days missing from the export yield an empty dataset.
+func (e *Export) FetchIntradayHeartRate(date, startTime, endTime string) (*fitbit.HeartRateResponse, error) {
+	from, err := time.ParseInLocation("2006-01-02 15:04", date+" "+startTime, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time: %v", err)
+	}
+	to, err := time.ParseInLocation("2006-01-02 15:04", date+" "+endTime, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time: %v", err)
+	}
+	// Like the API, the end minute is inclusive.
+	to = to.Add(time.Minute)
+
+	var resp fitbit.HeartRateResponse
+	// The files are split by UTC date, which may not match the local date.
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		samples, err := e.heartRateFor(day.Format("2006-01-02"))
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range samples {
+			if s.time.Before(from) || !s.time.Before(to) {
+				continue
+			}
+			resp.ActivitiesHeartIntraday.Dataset = append(resp.ActivitiesHeartIntraday.Dataset, fitbit.IntradayPoint{
+				Time:  s.time.In(time.Local).Format("15:04:05"),
+				Value: s.bpm,
+			})
+		}
+	}
+	return &resp, nil
+}
+
+func (e *Export) heartRateFor(utcDate string) ([]sample, error) {
+	if samples, ok := e.heartRate[utcDate]; ok {
+		return samples, nil
+	}
+	p, ok := e.files["heart_rate-"+utcDate+".json"]
+	if !ok {
+		e.heartRate[utcDate] = nil
+		return nil, nil
+	}
+
+	var points []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			BPM json.Number `json:"bpm"`
+		} `json:"value"`
+	}
+	if err := e.decode(p, &points); err != nil {
+		return nil, err
+	}
+
+	samples := make([]sample, 0, len(points))
+	for _, pt := range points {
+		t, err := time.ParseInLocation(exportTime, pt.DateTime, time.UTC)
+		if err != nil {
+			continue
+		}
+		bpm, err := strconv.ParseFloat(pt.Value.BPM.String(), 64)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, sample{time: t, bpm: bpm})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].time.Before(samples[j].time) })
+	e.heartRate[utcDate] = samples
+	return samples, nil
+}
+
+func (e *Export) decode(p string, v any) error {
+	f, err := e.fsys.Open(p)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", p, err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package fitbit
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Subscription asks Fitbit to notify a subscriber endpoint when the user's
+// activities change.
+type Subscription struct {
+	CollectionType string `json:"collectionType"`
+	OwnerID        string `json:"ownerId"`
+	OwnerType      string `json:"ownerType"`
+	SubscriberID   string `json:"subscriberId"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+// Notification is one entry of the JSON array Fitbit POSTs to a
+// subscriber. Date is the day whose data changed, YYYY-MM-DD.
+type Notification struct {
+	CollectionType string `json:"collectionType"`
+	Date           string `json:"date"`
+	OwnerID        string `json:"ownerId"`
+	OwnerType      string `json:"ownerType"`
+	SubscriptionID string `json:"subscriptionId"`
+}
+
+func subscriptionURL(id string) string {
+	return fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/apiSubscriptions/%s.json", url.PathEscape(id))
+}
+
+// AddSubscription subscribes to the user's activities under id, which must
+// be unique for the user. subscriberID picks one of the app's subscriber
+// endpoints; empty means the default one.
+func (c *Client) AddSubscription(id, subscriberID string) (*Subscription, error) {
+	req, err := http.NewRequest("POST", subscriptionURL(id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if subscriberID != "" {
+		req.Header.Set("X-Fitbit-Subscriber-Id", subscriberID)
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 200 means it already existed.
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var sub Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&sub); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription: %v", err)
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions returns the user's activity subscriptions.
+func (c *Client) ListSubscriptions() ([]Subscription, error) {
+	resp, err := c.HttpClient.Get("https://api.fitbit.com/1/user/-/activities/apiSubscriptions.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var list struct {
+		Subscriptions []Subscription `json:"apiSubscriptions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode subscriptions: %v", err)
+	}
+	return list.Subscriptions, nil
+}
+
+// DeleteSubscription removes the activity subscription id.
+func (c *Client) DeleteSubscription(id, subscriberID string) error {
+	req, err := http.NewRequest("DELETE", subscriptionURL(id), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if subscriberID != "" {
+		req.Header.Set("X-Fitbit-Subscriber-Id", subscriberID)
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp)
+	}
+	return nil
+}
+
+// ValidSignature checks the X-Fitbit-Signature header of a notification:
+// the base64 HMAC-SHA1 of the body, keyed with the client secret and "&".
+func ValidSignature(body []byte, signature, clientSecret string) bool {
+	want, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(clientSecret+"&"))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"fitbit-strava/encoder"
+	"fitbit-strava/logging"
+	"fitbit-strava/pipeline"
+)
+
+// setupLogging takes -log-level and -log-format out of args, wherever they
+// appear before a "--", configures logging to stderr and returns the rest.
+func setupLogging(args []string) ([]string, error) {
+	values := map[string]string{"log-level": "info", "log-format": "text"}
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if _, ok := values[name]; !ok || !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag needs an argument: -%s", name)
+			}
+			i++
+			value = args[i]
+		}
+		values[name] = value
+	}
+	return rest, logging.Setup(os.Stderr, values["log-level"], values["log-format"])
+}
+
+// windowFlags select a time range by hand, for activities Fitbit hasn't
+// logged.
+type windowFlags struct {
+	date     *string
+	start    *string
+	duration *int
+}
+
+func newWindowFlags(fs *flag.FlagSet) windowFlags {
+	return windowFlags{
+		date:     fs.String("date", "", "Date (YYYY-MM-DD, default today)"),
+		start:    fs.String("start", "", "Start time (HH:mm)"),
+		duration: fs.Int("duration", 60, "Duration in minutes"),
+	}
+}
+
+// set reports whether a time range was given.
+func (f windowFlags) set() bool { return *f.start != "" }
+
+func (f windowFlags) window() (pipeline.Window, error) {
+	date := *f.date
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+*f.start, time.Local)
+	if err != nil {
+		return pipeline.Window{}, fmt.Errorf("invalid date or start time: %v", err)
+	}
+	if *f.duration <= 0 {
+		return pipeline.Window{}, fmt.Errorf("invalid duration %d", *f.duration)
+	}
+	return pipeline.Window{Start: start, Duration: time.Duration(*f.duration) * time.Minute}, nil
+}
+
+// encodeFlags control the generated file.
+type encodeFlags struct {
+	format   *string
+	lapEvery *time.Duration
+	autoLaps *bool
+	clean    hrCleanFlags
+}
+
+func newEncodeFlags(fs *flag.FlagSet) encodeFlags {
+	return encodeFlags{
+		format:   fs.String("format", "fit", "Output format: fit, tcx or gpx (only for workouts with positions)"),
+		lapEvery: fs.Duration("lap-every", 0, "Split the activity into fixed-length laps (e.g. 5m)"),
+		autoLaps: fs.Bool("auto-laps", false, "Detect work/rest intervals from heart rate and write them as laps"),
+		clean:    newHRCleanFlags(fs),
+	}
+}
+
+func (f encodeFlags) options() (pipeline.Options, error) {
+	format, err := encoder.ParseFormat(*f.format)
+	if err != nil {
+		return pipeline.Options{}, err
+	}
+	return pipeline.Options{
+		Format: format,
+		Laps:   encoder.LapOptions{Every: *f.lapEvery, DetectIntervals: *f.autoLaps},
+		Clean:  f.clean.options,
+	}, nil
+}
+
+// gpsFlags control GPS activities, which are forwarded as Fitbit's own TCX.
+type gpsFlags struct {
+	include *bool
+	tcxHR   *bool
+}
+
+func newGPSFlags(fs *flag.FlagSet) gpsFlags {
+	return gpsFlags{
+		include: fs.Bool("gps", false, "Include GPS activities and upload Fitbit's own TCX for them"),
+		tcxHR:   fs.Bool("tcx-hr", false, "Fill in TCX heart rate from the 1-second series (with -gps)"),
+	}
+}
+
+// hrCleanFlags holds the heart rate cleaning flags. Flags that are not set
+// on the command line keep the sport's defaults.
+type hrCleanFlags struct {
+	fs             *flag.FlagSet
+	disable        *bool
+	min, max       *int
+	spike          *int
+	maxGap, smooth *time.Duration
+}
+
+func newHRCleanFlags(fs *flag.FlagSet) hrCleanFlags {
+	return hrCleanFlags{
+		fs:      fs,
+		disable: fs.Bool("no-hr-clean", false, "Upload heart rate exactly as Fitbit recorded it"),
+		min:     fs.Int("hr-min", 0, "Drop heart rate below this bpm (default per sport)"),
+		max:     fs.Int("hr-max", 0, "Drop heart rate above this bpm (default per sport)"),
+		spike:   fs.Int("hr-spike", 0, "Drop samples this many bpm from the rolling median (default per sport)"),
+		maxGap:  fs.Duration("hr-max-gap", 0, "Interpolate heart rate dropouts up to this long (default per sport)"),
+		smooth:  fs.Duration("hr-smooth", 0, "Moving-average window for heart rate, 0 to disable (default per sport)"),
+	}
+}
+
+// options returns the cleaning options for an activity, or nil when cleaning
+// is disabled.
+func (f hrCleanFlags) options(activityName string) *encoder.CleanOptions {
+	if *f.disable {
+		return nil
+	}
+	opts := encoder.CleanOptionsFor(activityName)
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "hr-min":
+			opts.MinHR = uint8(min(max(*f.min, 0), 255))
+		case "hr-max":
+			opts.MaxHR = uint8(min(max(*f.max, 0), 255))
+		case "hr-spike":
+			opts.SpikeThreshold = uint8(min(max(*f.spike, 0), 255))
+		case "hr-max-gap":
+			opts.MaxGap = *f.maxGap
+		case "hr-smooth":
+			opts.Smoothing = *f.smooth
+		}
+	})
+	return &opts
+}
+
+// pipelineOptions wraps the cleaning flags for commands that don't encode.
+func (f hrCleanFlags) pipelineOptions() pipeline.Options {
+	return pipeline.Options{Clean: f.options}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"fitbit-strava/auth"
+	"fitbit-strava/config"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/metrics"
+	"fitbit-strava/pipeline"
+)
+
+// observe adds /metrics and /healthz to mux.
+func observe(mux *http.ServeMux, cfg *config.Config, authenticator *auth.Authenticator) {
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", healthHandler(cfg, authenticator))
+}
+
+// healthHandler reports whether the Fitbit token and, if Strava is a
+// destination, the Strava token are usable: 200 if so, 503 if not.
+func healthHandler(cfg *config.Config, authenticator *auth.Authenticator) http.Handler {
+	providers := []string{"fitbit"}
+	if cfg.HasDestination("strava") {
+		providers = append(providers, "strava")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := struct {
+			Status string                      `json:"status"`
+			Tokens map[string]auth.TokenStatus `json:"tokens"`
+		}{Status: "ok", Tokens: make(map[string]auth.TokenStatus)}
+		code := http.StatusOK
+		for _, provider := range providers {
+			status := authenticator.Status(provider)
+			health.Tokens[provider] = status
+			if !status.Valid {
+				health.Status = "unhealthy"
+				code = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
+// serveObservability serves /metrics and /healthz on addr until ctx is
+// done.
+func serveObservability(ctx context.Context, addr string, cfg *config.Config, authenticator *auth.Authenticator) {
+	mux := http.NewServeMux()
+	observe(mux, cfg, authenticator)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+}
+
+// discoveries holds the log ids of the activities a long-running command
+// has picked up to sync, so each counts as discovered once, however often it
+// is retried. Activities left waiting for a device sync aren't counted until
+// they are picked up.
+type discoveries map[int64]bool
+
+func (d discoveries) add(act fitbit.ActivityLog) {
+	if !d[act.LogID] {
+		d[act.LogID] = true
+		metrics.Activities.Inc("discovered")
+	}
+}
+
+// observeActivity counts the outcome of syncing an activity in a
+// long-running command and notifies about it.
+func observeActivity(p *pipeline.Pipeline, command string, res activityResult) {
+	if e, ok := activityEvent(command, res); ok {
+		p.Notify.Send(e)
+	}
+	switch res.Status {
+	case statusUploaded:
+		metrics.Activities.Inc("synced")
+	case statusSkipped:
+		metrics.Activities.Inc("skipped")
+	case statusFailed, statusPartial:
+		metrics.Activities.Inc("failed")
+	}
+}
+
+// observeRun notifies about one check of a long-running command, given its
+// results and the error that cut it short, if any.
+func observeRun(p *pipeline.Pipeline, command string, results []activityResult, err error) {
+	if err != nil {
+		results = append(results, activityResult{}.failed(err))
+	}
+	if e, ok := runEvent(command, results); ok {
+		p.Notify.Send(e)
+	}
+}
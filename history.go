@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"fitbit-strava/ledger"
+)
+
+// runHistory implements `fitbit-strava history`: print the uploads recorded
+// in the sync ledger, newest first.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "Show this many activities, 0 for all")
+	dest := fs.String("destination", "", "Only show uploads to this destination")
+	output := outputFlag(fs, "a JSON array")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava history [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	book, err := ledger.Load()
+	if err != nil {
+		return reportError(fmt.Errorf("failed to load sync ledger: %v", err))
+	}
+
+	keys := make([]string, 0, len(book.Entries))
+	for key, e := range book.Entries {
+		if _, ok := e.Uploads[*dest]; *dest != "" && !ok {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return book.Entries[keys[i]].StartTime.After(book.Entries[keys[j]].StartTime)
+	})
+	if *limit > 0 && len(keys) > *limit {
+		keys = keys[:*limit]
+	}
+
+	if *output == "json" {
+		type historyEntry struct {
+			Source string `json:"source"`
+			*ledger.Entry
+		}
+		entries := make([]historyEntry, len(keys))
+		for i, key := range keys {
+			entries[i] = historyEntry{Source: key, Entry: book.Entries[key]}
+		}
+		if err := printJSON(entries); err != nil {
+			return reportError(err)
+		}
+		return exitOK
+	}
+	if len(keys) == 0 {
+		fmt.Println("No uploads recorded.")
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tNAME\tSPORT\tSOURCE\tUPLOADS")
+	for _, key := range keys {
+		e := book.Entries[key]
+		var uploads []string
+		for name, u := range e.Uploads {
+			if *dest != "" && name != *dest {
+				continue
+			}
+			id := u.ID
+			if id == "" && u.UploadID != "" {
+				id = "upload " + u.UploadID
+			}
+			if !u.DeletedAt.IsZero() {
+				id += " (deleted)"
+			}
+			uploads = append(uploads, name+" "+id)
+		}
+		sort.Strings(uploads)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.StartTime.Local().Format("2006-01-02 15:04"), e.Name, e.Sport, key, strings.Join(uploads, ", "))
+	}
+	tw.Flush()
+	return 0
+}
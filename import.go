@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/fitbit/export"
+	"fitbit-strava/pipeline"
+
+	"github.com/charmbracelet/huh"
+)
+
+// runImport implements `fitbit-strava import <export>`: it builds activity
+// files from a Fitbit data export instead of the API and uploads them.
+// The export stands in for the API as the pipeline's source, so activities
+// are encoded and named as `sync` would. Activities the ledger has synced
+// everywhere are left out, so a backfill can be run again.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	from := fs.String("from", "", "Only import activities on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Only import activities on or before this date (YYYY-MM-DD)")
+	includeGPS := fs.Bool("gps", false, "Also import GPS activities (heart rate only; the export has no track)")
+	dryRun := fs.Bool("dry-run", false, "Write the activity files but do not upload them")
+	outDir := fs.String("out", ".", "Directory for files written with -dry-run")
+	yes := fs.Bool("yes", false, "Upload without asking for confirmation")
+	encode := newEncodeFlags(fs)
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava import [flags] <export directory or .zip>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	opts, err := encode.options()
+	if err != nil {
+		return report.fail(err)
+	}
+
+	exp, err := export.Open(fs.Arg(0))
+	if err != nil {
+		return report.fail(err)
+	}
+	defer exp.Close()
+
+	activities, err := exp.Activities()
+	if err != nil {
+		return report.fail(err)
+	}
+
+	cfg, authenticator := loadAuth()
+	p := pipeline.New(cfg, nil, nil, loadLedger())
+	p.Source = exp
+
+	var selected []fitbit.ActivityLog
+	synced := 0
+	for _, act := range activities {
+		date := act.StartTime[:len("2006-01-02")]
+		if (*from != "" && date < *from) || (*to != "" && date > *to) {
+			continue
+		}
+		if act.HasGPS && !*includeGPS {
+			continue
+		}
+		if !*dryRun && p.Synced(act) {
+			synced++
+			continue
+		}
+		selected = append(selected, act)
+	}
+	if synced > 0 {
+		slog.Info("Leaving out activities already synced", "count", synced)
+	}
+	if len(selected) == 0 {
+		report.textf("No activities to import.\n")
+		return exitNothingToDo
+	}
+	slog.Info("Found activities to import", "count", len(selected))
+
+	if !*dryRun {
+		p.Destinations = setupDestinations(cfg, authenticator)
+		p.Notify = setupNotify(cfg)
+		report.notify = p.Notify
+		if !*yes {
+			var confirm bool
+			err := huh.NewConfirm().
+				Title(fmt.Sprintf("Upload %d activities to %s?", len(selected), destination.Names(p.Destinations))).
+				Value(&confirm).
+				Run()
+			if err != nil || !confirm {
+				report.textf("Upload cancelled.\n")
+				return exitNothingToDo
+			}
+		}
+	}
+
+	imported := 0
+	for _, act := range selected {
+		res := activityResult{LogID: act.LogID, Name: act.Name}
+		win, err := pipeline.WindowFor(act)
+		if err != nil {
+			slog.Warn("Invalid activity", "name", act.Name, "log_id", act.LogID, "error", err)
+			report.add(res.failed(err))
+			continue
+		}
+		res.StartTime = win.Start
+		slog.Info("Importing", "name", act.Name, "log_id", act.LogID, "start", win.Start, "duration", win.Duration)
+
+		// The export has no track, so GPS activities are built from heart
+		// rate like the rest.
+		hrOnly := act
+		hrOnly.HasGPS = false
+		built, err := buildActivity(p, &hrOnly, win, opts, gpsFlags{})
+		if errors.Is(err, pipeline.ErrNoHeartRate) || errors.Is(err, pipeline.ErrSkipped) {
+			slog.Info("Skipping activity", "name", act.Name, "log_id", act.LogID, "reason", err)
+			report.add(res.failed(err))
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to build activity", "name", act.Name, "log_id", act.LogID, "error", err)
+			report.add(res.failed(err))
+			continue
+		}
+		res.Name = built.Name
+
+		if *dryRun {
+			res.File = filepath.Join(*outDir, fmt.Sprintf("fitbit-%d.%s", act.LogID, built.Format))
+			if err := os.WriteFile(res.File, built.Data, 0644); err != nil {
+				slog.Warn("Failed to write file", "file", res.File, "error", err)
+				report.add(res.failed(fmt.Errorf("failed to write file: %v", err)))
+				continue
+			}
+			res.Status = statusSaved
+			imported++
+			report.add(res)
+			continue
+		}
+
+		res = res.uploaded(p.Upload(built))
+		if res.Status == statusUploaded {
+			imported++
+		}
+		report.add(res)
+	}
+
+	report.textf("Imported %d of %d activities.\n", imported, len(selected))
+	if *dryRun {
+		report.textf("Files saved to %s\n", *outDir)
+	}
+	return report.finish()
+}
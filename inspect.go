@@ -0,0 +1,277 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"fitbit-strava/encoder"
+)
+
+// runInspect implements `fitbit-strava inspect <file.fit>`. It returns the
+// process exit code: 1 if the file can't be decoded or has errors.
+func runInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	output := outputFlag(fs, "a JSON object")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava inspect [flags] <file.fit>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	report, err := encoder.Inspect(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *output == "json" {
+		if err := printJSON(inspectedReport(report)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else {
+		printReport(os.Stdout, report)
+	}
+
+	if report.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+// inspected is the JSON form of an encoder.Report. It has the fields
+// printReport prints, with times in UTC and durations in seconds.
+type inspected struct {
+	FileID struct {
+		Type         string    `json:"type"`
+		Manufacturer string    `json:"manufacturer"`
+		Product      uint16    `json:"product"`
+		ProductName  string    `json:"product_name,omitempty"`
+		SerialNumber uint32    `json:"serial_number"`
+		Created      time.Time `json:"created,omitzero"`
+	} `json:"file_id"`
+	Devices   []inspectedDevice  `json:"devices"`
+	Activity  *inspectedActivity `json:"activity,omitempty"`
+	Sessions  []inspectedSession `json:"sessions"`
+	Laps      []inspectedLap     `json:"laps"`
+	Events    int                `json:"events"`
+	Records   int                `json:"records"`
+	Histogram []encoder.HRBucket `json:"heart_rate_histogram"`
+	Problems  []encoder.Problem  `json:"problems"`
+}
+
+type inspectedActivity struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Sessions         uint16    `json:"sessions"`
+	TimerTimeSeconds *float64  `json:"timer_time_seconds,omitempty"`
+}
+
+type inspectedDevice struct {
+	Manufacturer    string `json:"manufacturer"`
+	Product         uint16 `json:"product"`
+	ProductName     string `json:"product_name,omitempty"`
+	SerialNumber    uint32 `json:"serial_number"`
+	SoftwareVersion uint16 `json:"software_version"`
+	BatteryStatus   string `json:"battery_status"`
+}
+
+type inspectedSession struct {
+	Sport          string    `json:"sport"`
+	SubSport       string    `json:"sub_sport"`
+	Profile        string    `json:"profile,omitempty"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	ElapsedSeconds *float64  `json:"elapsed_seconds,omitempty"`
+	AvgHeartRate   uint8     `json:"avg_heart_rate"`
+	MaxHeartRate   uint8     `json:"max_heart_rate"`
+	MinHeartRate   uint8     `json:"min_heart_rate"`
+	Calories       uint16    `json:"calories"`
+	DistanceMeters float64   `json:"distance_meters,omitempty"`
+	Laps           uint16    `json:"laps"`
+}
+
+type inspectedLap struct {
+	Start          time.Time `json:"start"`
+	ElapsedSeconds *float64  `json:"elapsed_seconds,omitempty"`
+	AvgHeartRate   uint8     `json:"avg_heart_rate"`
+	MaxHeartRate   uint8     `json:"max_heart_rate"`
+	Calories       uint16    `json:"calories"`
+	Intensity      string    `json:"intensity"`
+}
+
+func inspectedReport(r *encoder.Report) inspected {
+	var out inspected
+	out.FileID.Type = r.FileID.Type.String()
+	out.FileID.Manufacturer = r.FileID.Manufacturer.String()
+	out.FileID.Product = r.FileID.Product
+	out.FileID.ProductName = r.FileID.ProductName
+	out.FileID.SerialNumber = r.FileID.SerialNumber
+	out.FileID.Created = r.FileID.TimeCreated.UTC()
+
+	out.Devices = []inspectedDevice{}
+	for _, d := range r.Devices {
+		out.Devices = append(out.Devices, inspectedDevice{
+			Manufacturer:    d.Manufacturer.String(),
+			Product:         d.Product,
+			ProductName:     d.ProductName,
+			SerialNumber:    d.SerialNumber,
+			SoftwareVersion: d.SoftwareVersion,
+			BatteryStatus:   d.BatteryStatus.String(),
+		})
+	}
+
+	if a := r.Activity; a != nil {
+		out.Activity = &inspectedActivity{
+			Timestamp:        a.Timestamp.UTC(),
+			Sessions:         a.NumSessions,
+			TimerTimeSeconds: fitSeconds(a.TotalTimerTime),
+		}
+	}
+
+	out.Sessions = []inspectedSession{}
+	for _, s := range r.Sessions {
+		is := inspectedSession{
+			Sport:          s.Sport.String(),
+			SubSport:       s.SubSport.String(),
+			Profile:        s.SportProfileName,
+			Start:          s.StartTime.UTC(),
+			End:            s.Timestamp.UTC(),
+			ElapsedSeconds: fitSeconds(s.TotalElapsedTime),
+			AvgHeartRate:   s.AvgHeartRate,
+			MaxHeartRate:   s.MaxHeartRate,
+			MinHeartRate:   s.MinHeartRate,
+			Calories:       s.TotalCalories,
+			Laps:           s.NumLaps,
+		}
+		if s.TotalDistance != 0xFFFFFFFF {
+			is.DistanceMeters = float64(s.TotalDistance) / 100
+		}
+		out.Sessions = append(out.Sessions, is)
+	}
+
+	out.Laps = []inspectedLap{}
+	for _, l := range r.Laps {
+		out.Laps = append(out.Laps, inspectedLap{
+			Start:          l.StartTime.UTC(),
+			ElapsedSeconds: fitSeconds(l.TotalElapsedTime),
+			AvgHeartRate:   l.AvgHeartRate,
+			MaxHeartRate:   l.MaxHeartRate,
+			Calories:       l.TotalCalories,
+			Intensity:      l.Intensity.String(),
+		})
+	}
+
+	out.Events = len(r.Events)
+	out.Records = r.Records
+	out.Histogram = append([]encoder.HRBucket{}, r.Histogram...)
+	out.Problems = append([]encoder.Problem{}, r.Problems...)
+	return out
+}
+
+func printReport(w io.Writer, r *encoder.Report) {
+	const timeLayout = "2006-01-02 15:04:05"
+
+	fmt.Fprintln(w, "File ID")
+	fmt.Fprintf(w, "  Type:          %v\n", r.FileID.Type)
+	fmt.Fprintf(w, "  Manufacturer:  %v\n", r.FileID.Manufacturer)
+	fmt.Fprintf(w, "  Product:       %d %s\n", r.FileID.Product, r.FileID.ProductName)
+	fmt.Fprintf(w, "  Serial:        %d\n", r.FileID.SerialNumber)
+	fmt.Fprintf(w, "  Created:       %s\n", r.FileID.TimeCreated.Local().Format(timeLayout))
+
+	for i, d := range r.Devices {
+		fmt.Fprintf(w, "Device %d\n", i)
+		fmt.Fprintf(w, "  Manufacturer:  %v\n", d.Manufacturer)
+		fmt.Fprintf(w, "  Product:       %d %s\n", d.Product, d.ProductName)
+		fmt.Fprintf(w, "  Serial:        %d\n", d.SerialNumber)
+		fmt.Fprintf(w, "  Software:      %d\n", d.SoftwareVersion)
+		fmt.Fprintf(w, "  Battery:       %v\n", d.BatteryStatus)
+	}
+
+	if a := r.Activity; a != nil {
+		fmt.Fprintln(w, "Activity")
+		fmt.Fprintf(w, "  Timestamp:     %s\n", a.Timestamp.Local().Format(timeLayout))
+		fmt.Fprintf(w, "  Sessions:      %d\n", a.NumSessions)
+		fmt.Fprintf(w, "  Timer time:    %s\n", fitDuration(a.TotalTimerTime))
+	}
+
+	for i, s := range r.Sessions {
+		fmt.Fprintf(w, "Session %d: %v/%v %s\n", i, s.Sport, s.SubSport, s.SportProfileName)
+		fmt.Fprintf(w, "  Start:         %s\n", s.StartTime.Local().Format(timeLayout))
+		fmt.Fprintf(w, "  End:           %s\n", s.Timestamp.Local().Format(timeLayout))
+		fmt.Fprintf(w, "  Elapsed:       %s\n", fitDuration(s.TotalElapsedTime))
+		fmt.Fprintf(w, "  Heart rate:    avg %d, max %d, min %d\n", s.AvgHeartRate, s.MaxHeartRate, s.MinHeartRate)
+		fmt.Fprintf(w, "  Calories:      %d\n", s.TotalCalories)
+		if s.TotalDistance != 0 && s.TotalDistance != 0xFFFFFFFF {
+			fmt.Fprintf(w, "  Distance:      %.2f km\n", float64(s.TotalDistance)/100000)
+		}
+		fmt.Fprintf(w, "  Laps:          %d\n", s.NumLaps)
+	}
+
+	for i, l := range r.Laps {
+		fmt.Fprintf(w, "  Lap %-3d %s  %8s  avg %3d max %3d  %4d cal  %v\n", i,
+			l.StartTime.Local().Format("15:04:05"), fitDuration(l.TotalElapsedTime),
+			l.AvgHeartRate, l.MaxHeartRate, l.TotalCalories, l.Intensity)
+	}
+
+	fmt.Fprintf(w, "Events:          %d\n", len(r.Events))
+	fmt.Fprintf(w, "Records:         %d\n", r.Records)
+
+	if len(r.Histogram) > 0 {
+		fmt.Fprintln(w, "Heart rate histogram")
+		peak := 0
+		for _, b := range r.Histogram {
+			peak = max(peak, b.Count)
+		}
+		for _, b := range r.Histogram {
+			bar := strings.Repeat("#", b.Count*40/max(peak, 1))
+			fmt.Fprintf(w, "  %3d-%-3d %6d %s\n", b.Low, b.Low+9, b.Count, bar)
+		}
+	}
+
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(w, "No problems found.")
+		return
+	}
+	fmt.Fprintln(w, "Problems")
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "  %s: %s\n", p.Severity, p.Message)
+	}
+}
+
+// fitSeconds converts a FIT time field (milliseconds) to seconds, or nil if
+// it is invalid.
+func fitSeconds(ms uint32) *float64 {
+	if ms == 0xFFFFFFFF {
+		return nil
+	}
+	secs := float64(ms) / 1000
+	return &secs
+}
+
+// fitDuration formats a FIT time field (milliseconds).
+func fitDuration(ms uint32) string {
+	if ms == 0xFFFFFFFF {
+		return "-"
+	}
+	secs := ms / 1000
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
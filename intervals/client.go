@@ -0,0 +1,112 @@
+package intervals
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+const baseURL = "https://intervals.icu/api/v1"
+
+type ActivityMetadata struct {
+	Name        string
+	Description string
+	ExternalID  string
+}
+
+// UploadResponse is the part of the created activity we use.
+type UploadResponse struct {
+	ID string `json:"id"`
+}
+
+// APIError is an unsuccessful response from the intervals.icu API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("intervals.icu api error: status %s, body %s", e.Status, e.Body)
+}
+
+// RateLimited reports whether too many requests were made.
+func (e *APIError) RateLimited() bool { return e.StatusCode == http.StatusTooManyRequests }
+
+// Unauthorized reports whether the API key was rejected.
+func (e *APIError) Unauthorized() bool { return e.StatusCode == http.StatusUnauthorized }
+
+// Client talks to the intervals.icu API using an API key from the
+// athlete's settings page.
+type Client struct {
+	HttpClient *http.Client
+	AthleteID  string // "0" means the athlete the key belongs to
+	APIKey     string
+}
+
+func NewClient(client *http.Client, athleteID, apiKey string) *Client {
+	if athleteID == "" {
+		athleteID = "0"
+	}
+	return &Client{HttpClient: client, AthleteID: athleteID, APIKey: apiKey}
+}
+
+// Upload creates an activity from a FIT, TCX or GPX file and returns its id.
+func (c *Client) Upload(data io.Reader, filename string, metadata ActivityMetadata) (*UploadResponse, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return nil, fmt.Errorf("failed to read activity data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close writer: %v", err)
+	}
+
+	query := url.Values{}
+	if metadata.Name != "" {
+		query.Set("name", metadata.Name)
+	}
+	if metadata.Description != "" {
+		query.Set("description", metadata.Description)
+	}
+	if metadata.ExternalID != "" {
+		query.Set("external_id", metadata.ExternalID)
+	}
+	endpoint := fmt.Sprintf("%s/athlete/%s/activities", baseURL, url.PathEscape(c.AthleteID))
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("POST", endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.SetBasicAuth("API_KEY", c.APIKey)
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+	}
+
+	var created UploadResponse
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return nil, fmt.Errorf("failed to decode upload response: %v", err)
+	}
+	return &created, nil
+}
@@ -0,0 +1,70 @@
+package intervals
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// redirect sends every request to the test server instead of intervals.icu.
+type redirect struct{ target *url.URL }
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	return NewClient(&http.Client{Transport: redirect{target}}, "", "key")
+}
+
+func TestUpload(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "API_KEY" || pass != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/athlete/0/activities" || r.URL.Query().Get("external_id") != "fitbit-1234" {
+			t.Errorf("request to %s", r.URL)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"i42"}`))
+	})
+	created, err := c.Upload(strings.NewReader("fit"), "workout.fit", ActivityMetadata{Name: "Ride", ExternalID: "fitbit-1234"})
+	if err != nil || created.ID != "i42" {
+		t.Errorf("Upload = %+v, %v", created, err)
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	tests := []struct {
+		status       int
+		unauthorized bool
+		rateLimited  bool
+	}{
+		{http.StatusUnauthorized, true, false},
+		{http.StatusTooManyRequests, false, true},
+		{http.StatusUnprocessableEntity, false, false},
+	}
+	for _, tt := range tests {
+		c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", tt.status)
+		})
+		_, err := c.Upload(strings.NewReader("fit"), "workout.fit", ActivityMetadata{})
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("status %d: error %v is not an *APIError", tt.status, err)
+		}
+		if apiErr.StatusCode != tt.status || apiErr.Unauthorized() != tt.unauthorized || apiErr.RateLimited() != tt.rateLimited {
+			t.Errorf("status %d: got %+v, unauthorized %v, rate limited %v", tt.status, apiErr, apiErr.Unauthorized(), apiErr.RateLimited())
+		}
+	}
+}
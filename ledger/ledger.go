@@ -0,0 +1,262 @@
+// Package ledger records which activities were synced where, so later runs
+// can tell what has already been uploaded.
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const LedgerFile = "ledger.json"
+
+// lockFileName is locked while a process changes the ledger, so that
+// processes sharing it, such as daemon and serve, don't overwrite each
+// other's records.
+const lockFileName = LedgerFile + ".lock"
+
+// Entry is one source activity and its uploads.
+type Entry struct {
+	Name      string    `json:"name"`
+	Sport     string    `json:"sport,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	// Uploads are keyed by destination name.
+	Uploads map[string]Upload `json:"uploads"`
+	// Skipped is why the activity was passed over, e.g. for having no heart
+	// rate, so later runs don't try it again. Empty unless it was.
+	Skipped   string    `json:"skipped,omitempty"`
+	SkippedAt time.Time `json:"skipped_at,omitzero"`
+}
+
+// Upload is a successful upload to one destination.
+type Upload struct {
+	// ID is the destination's id for the activity, if it returns one.
+	ID string `json:"id,omitempty"`
+	// UploadID is the id of an upload still being processed when recorded.
+	UploadID   string    `json:"upload_id,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Name is the activity's name at the destination, once renamed there.
+	Name string `json:"name,omitempty"`
+	// DeletedAt is when the activity was deleted at the destination. It
+	// still counts as synced, so it isn't uploaded again by itself.
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+}
+
+type Ledger struct {
+	mu      sync.Mutex
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Load reads the ledger from ledger.json. A missing file is an empty ledger.
+func Load() (*Ledger, error) {
+	entries, err := readEntries()
+	if err != nil {
+		return nil, err
+	}
+	return &Ledger{Entries: entries}, nil
+}
+
+func readEntries() (map[string]*Entry, error) {
+	var l struct {
+		Entries map[string]*Entry `json:"entries"`
+	}
+	file, err := os.ReadFile(LedgerFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(file, &l); err != nil {
+			return nil, err
+		}
+	}
+	if l.Entries == nil {
+		l.Entries = make(map[string]*Entry)
+	}
+	return l.Entries, nil
+}
+
+// Reload replaces the entries with those in ledger.json, picking up changes
+// made by other processes.
+func (l *Ledger) Reload() error {
+	entries, err := readEntries()
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.Entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Save writes the ledger to ledger.json, replacing what other processes
+// recorded since it was loaded. Record, Skip and Update keep those records.
+func (l *Ledger) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return l.write()
+}
+
+// change reloads the entries from ledger.json, applies change to them and
+// saves them, all while holding the lock on ledger.json.lock, so that no
+// other process records anything in between.
+func (l *Ledger) change(change func()) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readEntries()
+	if err != nil {
+		return err
+	}
+	l.Entries = entries
+	change()
+	return l.write()
+}
+
+// write saves the entries to a temporary file and renames it over
+// ledger.json, so that a crash or a full disk can't leave a truncated
+// ledger behind. l.mu and the lock on ledger.json.lock must be held.
+func (l *Ledger) write() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(LedgerFile), LedgerFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), LedgerFile)
+}
+
+// lock takes the lock on ledger.json.lock, waiting for other processes to
+// release it, and returns a function that releases it.
+func lock() (func(), error) {
+	f, err := os.OpenFile(lockFileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger lock: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock ledger: %v", err)
+	}
+	return func() { f.Close() }, nil
+}
+
+// Get returns the entry for key, or nil.
+func (l *Ledger) Get(key string) *Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Entries[key]
+}
+
+// Uploaded returns the recorded upload of key to destination, if any.
+func (l *Ledger) Uploaded(key, destination string) (Upload, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.Entries[key]
+	if !ok {
+		return Upload{}, false
+	}
+	u, ok := e.Uploads[destination]
+	return u, ok
+}
+
+// Record notes a successful upload of the activity identified by key and
+// saves the ledger. entry describes the activity; its Uploads are ignored.
+// upload.UploadedAt defaults to now. An upload clears an earlier skip.
+func (l *Ledger) Record(key string, entry Entry, destination string, upload Upload) error {
+	if upload.UploadedAt.IsZero() {
+		upload.UploadedAt = time.Now()
+	}
+	return l.change(func() {
+		e := l.entry(key, entry)
+		e.Uploads[destination] = upload
+		e.Skipped, e.SkippedAt = "", time.Time{}
+	})
+}
+
+// Skip notes that the activity identified by key was passed over, and why,
+// and saves the ledger. entry describes the activity; its Uploads are
+// ignored.
+func (l *Ledger) Skip(key string, entry Entry, reason string) error {
+	return l.change(func() {
+		e := l.entry(key, entry)
+		e.Skipped, e.SkippedAt = reason, time.Now()
+	})
+}
+
+// entry returns the entry for key, created if need be, described by entry.
+// l.mu must be held.
+func (l *Ledger) entry(key string, entry Entry) *Entry {
+	e, ok := l.Entries[key]
+	if !ok {
+		e = &Entry{Uploads: make(map[string]Upload)}
+		l.Entries[key] = e
+	}
+	e.Name, e.Sport, e.StartTime = entry.Name, entry.Sport, entry.StartTime
+	return e
+}
+
+// Find returns the key of an entry whose upload to destination matches, or
+// "" if there is none.
+func (l *Ledger) Find(destination string, match func(Upload) bool) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, e := range l.Entries {
+		if u, ok := e.Uploads[destination]; ok && match(u) {
+			return key
+		}
+	}
+	return ""
+}
+
+// Update changes the recorded upload of key to destination and saves the
+// ledger. It reports false if there is no such upload.
+func (l *Ledger) Update(key, destination string, update func(*Upload)) (bool, error) {
+	found := false
+	err := l.change(func() {
+		e, ok := l.Entries[key]
+		if !ok {
+			return
+		}
+		u, ok := e.Uploads[destination]
+		if !ok {
+			return
+		}
+		update(&u)
+		e.Uploads[destination] = u
+		found = true
+	})
+	return found, err
+}
@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWritersKeepEachOthersRecords(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Each Ledger stands for a process, e.g. daemon and serve, loaded before
+	// the other recorded anything.
+	const writers, uploads = 4, 25
+	ledgers := make([]*Ledger, writers)
+	for i := range ledgers {
+		l, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ledgers[i] = l
+	}
+
+	var wg sync.WaitGroup
+	for i, l := range ledgers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range uploads {
+				key := fmt.Sprintf("fitbit-%d-%d", i, j)
+				if err := l.Record(key, Entry{Name: key}, "strava", Upload{ID: key}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	l, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Entries) != writers*uploads {
+		t.Errorf("%d entries saved, want %d", len(l.Entries), writers*uploads)
+	}
+	tmp, _ := filepath.Glob(LedgerFile + ".*.tmp")
+	if len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestUpdateSeesOtherProcesses(t *testing.T) {
+	t.Chdir(t.TempDir())
+	serve, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := daemon.Record("fitbit-1", Entry{Name: "Run"}, "strava", Upload{ID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ok, err := serve.Update("fitbit-1", "strava", func(u *Upload) { u.DeletedAt = deleted })
+	if err != nil || !ok {
+		t.Fatalf("Update = %v, %v; want the upload daemon recorded", ok, err)
+	}
+
+	if err := daemon.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := daemon.Uploaded("fitbit-1", "strava"); !u.DeletedAt.Equal(deleted) || u.ID != "42" {
+		t.Errorf("upload after update = %+v", u)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	l, err := Load()
+	if err != nil || len(l.Entries) != 0 {
+		t.Fatalf("Load = %v, %v; want an empty ledger", l.Entries, err)
+	}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(LedgerFile); err != nil {
+		t.Error(err)
+	}
+}
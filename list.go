@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fitbit-strava/fitbit"
+	"fitbit-strava/pipeline"
+)
+
+// listedActivity is a row of `fitbit-strava list`, and its JSON form.
+type listedActivity struct {
+	LogID           int64     `json:"log_id"`
+	Name            string    `json:"name"`
+	Start           time.Time `json:"start"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Calories        int       `json:"calories"`
+	Device          string    `json:"device,omitempty"`
+	HasGPS          bool      `json:"has_gps"`
+	// Synced is whether every configured destination has it.
+	Synced bool `json:"synced"`
+	// Uploads maps destinations in the ledger to the id each returned.
+	Uploads map[string]string `json:"uploads"`
+	// Skipped is why a sync passed it over, if one did.
+	Skipped string `json:"skipped,omitempty"`
+	// StravaActivityID is set when -strava found the activity on Strava.
+	StravaActivityID int64 `json:"strava_activity_id,omitempty"`
+}
+
+// runList implements `fitbit-strava list`: print the recent Fitbit
+// activities and where each was synced.
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	days := fs.Int("days", 14, "Only list activities that started in the last this many days")
+	all := fs.Bool("all", false, "Include GPS activities, which sync skips unless given -gps")
+	checkStrava := fs.Bool("strava", false, "Also look the activities up on Strava, to find uploads the ledger doesn't know")
+	output := outputFlag(fs, "a JSON array")
+	fs.BoolFunc("json", "Same as -output json", func(string) error {
+		*output = "json"
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava list [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	cfg, authenticator := loadAuth()
+	p := pipeline.New(cfg, newFitbitClient(cfg, authenticator), nil, loadLedger())
+	since := time.Now().AddDate(0, 0, -*days)
+	recent, err := p.Since(since, *all)
+	if err != nil {
+		return reportError(fmt.Errorf("failed to fetch recent activities: %w", err))
+	}
+
+	var listed []listedActivity
+	var acts []fitbit.ActivityLog
+	for _, act := range recent {
+		start, _ := pipeline.StartTime(act)
+		l := listedActivity{
+			LogID:           act.LogID,
+			Name:            act.Name,
+			Start:           start,
+			DurationSeconds: act.Duration / 1000,
+			Calories:        act.Calories,
+			Device:          act.Source.Name,
+			HasGPS:          act.HasGPS,
+			Synced:          p.Synced(act),
+			Uploads:         map[string]string{},
+		}
+		if entry := p.Ledger.Get(pipeline.ExternalID(act)); entry != nil {
+			for name, u := range entry.Uploads {
+				l.Uploads[name] = u.ID
+			}
+			l.Skipped = entry.Skipped
+		}
+		listed = append(listed, l)
+		acts = append(acts, act)
+	}
+
+	if *checkStrava && len(listed) > 0 {
+		client := newStravaClient(cfg, authenticator)
+		// Strava's list is filtered by start time; pad for clock skew.
+		activities, err := client.ListActivities(since.Add(-time.Hour), time.Now().Add(time.Hour))
+		if err != nil {
+			slog.Warn("Failed to list Strava activities; run `fitbit-strava auth -reset strava` if the token predates the activity:read_all scope", "error", err)
+		} else {
+			for i, act := range acts {
+				if match := pipeline.MatchStrava(act, activities); match != nil {
+					listed[i].StravaActivityID = match.ID
+				}
+			}
+		}
+	}
+
+	if *output == "json" {
+		if listed == nil {
+			listed = []listedActivity{}
+		}
+		if err := printJSON(listed); err != nil {
+			return reportError(err)
+		}
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOG ID\tSTART\tNAME\tDURATION\tCALORIES\tDEVICE\tGPS\tSYNCED")
+	for _, l := range listed {
+		gps := ""
+		if l.HasGPS {
+			gps = "yes"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%dm\t%d\t%s\t%s\t%s\n", l.LogID, l.Start.Format("2006-01-02 15:04"), l.Name,
+			l.DurationSeconds/60, l.Calories, l.Device, gps, syncStatus(l))
+	}
+	tw.Flush()
+	return 0
+}
+
+// syncStatus summarizes where an activity was synced, e.g.
+// "strava, archive" or "strava (found 1234)" for an upload the ledger
+// doesn't have.
+func syncStatus(l listedActivity) string {
+	names := make([]string, 0, len(l.Uploads))
+	for name := range l.Uploads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if _, ok := l.Uploads["strava"]; !ok && l.StravaActivityID != 0 {
+		names = append(names, fmt.Sprintf("strava (found %d)", l.StravaActivityID))
+	}
+	if len(names) == 0 {
+		if l.Skipped != "" {
+			return "skipped: " + l.Skipped
+		}
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
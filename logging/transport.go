@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fitbit-strava/metrics"
+)
+
+// secretParams are query parameters that carry credentials.
+var secretParams = []string{"access_token", "refresh_token", "code", "client_secret", "token"}
+
+// Transport counts every request in the metrics and logs it at debug
+// level: method, endpoint, status, latency and, where the API reports it,
+// the remaining rate limit. Headers and bodies are never logged, and
+// credentials in the URL are redacted.
+type Transport struct {
+	// Provider names the API in the log, e.g. "fitbit".
+	Provider string
+	// Base makes the requests; nil means http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport for provider over base.
+func NewTransport(provider string, base http.RoundTripper) *Transport {
+	return &Transport{Provider: provider, Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	debug := slog.Default().Enabled(req.Context(), slog.LevelDebug)
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	attrs := []slog.Attr{
+		slog.String("provider", t.Provider),
+		slog.String("method", req.Method),
+		slog.String("endpoint", RedactURL(req.URL)),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if err != nil {
+		metrics.APIRequests.Inc(t.Provider, "error")
+		if debug {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			slog.LogAttrs(req.Context(), slog.LevelDebug, "HTTP request failed", attrs...)
+		}
+		return nil, err
+	}
+	metrics.APIRequests.Inc(t.Provider, strconv.Itoa(resp.StatusCode))
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if remaining, ok := RateLimitRemaining(resp.Header); ok {
+		metrics.RateLimitRemaining.Set(float64(remaining), t.Provider)
+		attrs = append(attrs, slog.Int("ratelimit_remaining", remaining))
+	}
+	if debug {
+		slog.LogAttrs(req.Context(), slog.LevelDebug, "HTTP request", attrs...)
+	}
+	return resp, nil
+}
+
+// RedactURL formats u without its password or any credentials in the query.
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	if q := u.Query(); len(q) > 0 {
+		for _, name := range secretParams {
+			if q.Has(name) {
+				q.Set(name, "REDACTED")
+			}
+		}
+		redacted.RawQuery = q.Encode()
+	}
+	return redacted.Redacted()
+}
+
+// RateLimitRemaining reads how many requests are left from a response's
+// headers: Fitbit's Fitbit-Rate-Limit-Remaining, or the smaller of Strava's
+// 15-minute and daily allowances from X-RateLimit-Limit and
+// X-RateLimit-Usage.
+func RateLimitRemaining(h http.Header) (int, bool) {
+	if v := h.Get("Fitbit-Rate-Limit-Remaining"); v != "" {
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	limits, usages := strings.Split(h.Get("X-RateLimit-Limit"), ","), strings.Split(h.Get("X-RateLimit-Usage"), ",")
+	if len(limits) != len(usages) || limits[0] == "" {
+		return 0, false
+	}
+	remaining := -1
+	for i := range limits {
+		limit, err1 := strconv.Atoi(strings.TrimSpace(limits[i]))
+		usage, err2 := strconv.Atoi(strings.TrimSpace(usages[i]))
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		if left := limit - usage; remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining, true
+}
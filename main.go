@@ -2,341 +2,271 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
-	"log"
-	"strconv"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"fitbit-strava/auth"
 	"fitbit-strava/config"
-	"fitbit-strava/encoder"
+	"fitbit-strava/destination"
 	"fitbit-strava/fitbit"
+	"fitbit-strava/intervals"
+	"fitbit-strava/ledger"
+	"fitbit-strava/logging"
+	"fitbit-strava/pipeline"
+	"fitbit-strava/s3"
 	"fitbit-strava/strava"
+	"fitbit-strava/webdav"
 
-	"github.com/charmbracelet/huh"
-	"github.com/dustin/go-humanize"
 	"golang.org/x/oauth2"
 	fitbitOAuth "golang.org/x/oauth2/fitbit"
 )
 
-func main() {
-	// Flags
-	startTimeStr := flag.String("start", "", "Start time (HH:mm)")
-	durationMin := flag.Int("duration", 0, "Duration in minutes")
-	// Date defaults to today if not provided via flag, but we'll check if it was explicitly set later if needed,
-	// or just use the current value as default for the prompt.
-	dateStr := flag.String("date", "", "Date (YYYY-MM-DD)")
-	dryRun := flag.Bool("dry-run", false, "Generate FIT file but do not upload to Strava")
-	flag.Parse()
+// command is a subcommand. run gets the arguments after the command name
+// and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	// 1. Load Config & Auth EARLY
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+func commands() []command {
+	return []command{
+		{"pick", "Choose a recent activity interactively and upload it (default)", runPick},
+		{"sync", "Upload recent activities that haven't been synced yet", runSync},
+		{"daemon", "Keep syncing new activities every -interval", runDaemon},
+		{"serve", "Sync activities when Fitbit sends a notification", runServe},
+		{"subscription", "Add, list or delete the Fitbit or Strava subscription for serve", runSubscription},
+		{"upload", "Upload an existing FIT, TCX or GPX file", runUpload},
+		{"list", "List recent Fitbit activities", runList},
+		{"export", "Write an activity file without uploading it", runExport},
+		{"import", "Import activities from a Fitbit data export", runImport},
+		{"merge", "Add Fitbit heart rate to another device's FIT or TCX file", runMerge},
+		{"inspect", "Check a FIT file and print its summary", runInspect},
+		{"history", "Show uploads recorded in the sync ledger", runHistory},
+		{"auth", "Authorize Fitbit and the destinations", runAuth},
+		{"config", "Show the effective configuration", runConfig},
 	}
-	tokenStore, err := auth.LoadTokens()
+}
+
+func main() {
+	args, err := setupLogging(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Error loading token store: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
-	authenticator := auth.NewAuthenticator(tokenStore)
-
-	// 2. Authenticate Services
-	// Fitbit
-	fitbitConfig := &oauth2.Config{
-		ClientID:     cfg.FitbitClientID,
-		ClientSecret: cfg.FitbitClientSecret, // Fixed typo in variable name if strictly following config
-		RedirectURL:  "http://localhost:8080/callback",
-		Scopes:       []string{"heartrate", "activity"},
-		Endpoint:     fitbitOAuth.Endpoint,
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help") {
+		// Without a command, or with only flags as before commands existed,
+		// run the interactive flow.
+		os.Exit(runPick(args))
 	}
-	fitbitClient := fitbit.NewClient(authenticator.GetClient(context.Background(), "fitbit", fitbitConfig))
 
-	// Strava
-	stravaEndpoint := oauth2.Endpoint{
-		AuthURL:  "https://www.strava.com/oauth/mobile/authorize",
-		TokenURL: "https://www.strava.com/oauth/token",
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		os.Exit(0)
 	}
-	stravaOAuth := &oauth2.Config{
-		ClientID:     cfg.StravaClientID,
-		ClientSecret: cfg.StravaClientSecret,
-		RedirectURL:  "http://localhost:8080/callback",
-		Scopes:       []string{"activity:write"},
-		Endpoint:     stravaEndpoint,
+	for _, c := range commands() {
+		if c.name == name {
+			os.Exit(c.run(args[1:]))
+		}
 	}
-	stravaClient := strava.NewClient(authenticator.GetClient(context.Background(), "strava", stravaOAuth))
-
-	// Interactive Mode
-	interactive := false
-	var selectedActivity *fitbit.ActivityLog
-
-	if *startTimeStr == "" {
-		interactive = true
-
-		// 1. Activity Selection
-		// 0 = Manual, >0 = Activity Index (but we will use the pointer directly if possible or an ID)
-		// 0 = Manual, >0 = Activity Index (but we will use the pointer directly if possible or an ID)
-		// Let's use string keys for selection: "manual" or "logId"
-		var selectedAction string
-
-		// Fetch recent activities
-		recent, err := fitbitClient.GetRecentActivities(15)
-		if err == nil && len(recent.Activities) > 0 {
-			filteredActivities := make([]fitbit.ActivityLog, 0, len(recent.Activities))
-			for _, act := range recent.Activities {
-				// Exclude activities with GPS as they typically sync automatically to Strava
-				if act.HasGPS {
-					continue
-				}
-				filteredActivities = append(filteredActivities, act)
-			}
-
-			if len(filteredActivities) > 0 {
-				options := make([]huh.Option[string], 0, len(filteredActivities)+1)
-				for _, act := range filteredActivities {
-					// Parse time for nicer display
-					t, _ := time.Parse("2006-01-02T15:04:05.000-07:00", act.StartTime)
-					relativeTime := humanize.Time(t)
-					displayTime := t.Format("15:04") // Just time, date is in relative
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
 
-					durMin := act.Duration / 60000
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: fitbit-strava <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run `fitbit-strava <command> -h` for a command's flags. Every command also takes")
+	fmt.Fprintln(os.Stderr, "-log-level debug|info|warn|error (default info) and -log-format text|json (default text).")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Exit codes: 0 ok, 1 failed, 2 usage, 3 nothing to do, 4 partial failure,")
+	fmt.Fprintln(os.Stderr, "5 authorization required, 6 rate limited.")
+}
 
-					// e.g., "Strength Training - 2 hours ago (13:00) [304 cal]"
-					label := fmt.Sprintf("%s - %s (%s) [%dm, %d cal]", act.Name, relativeTime, displayTime, durMin, act.Calories)
-					// Use LogID as value, converted to string
-					options = append(options, huh.NewOption(label, strconv.FormatInt(act.LogID, 10)))
-				}
-				// Add manual entry option
-				options = append(options, huh.NewOption("Manual Entry", "manual"))
+// setupPipeline loads the config and ledger and authenticates with Fitbit
+// and the configured destinations, opening the browser for any service
+// without a saved token.
+func setupPipeline() *pipeline.Pipeline {
+	return newPipeline(loadAuth())
+}
 
-				form := huh.NewForm(
-					huh.NewGroup(
-						huh.NewSelect[string]().
-							Title("Select Fitbit Activity").
-							Options(options...).
-							Value(&selectedAction),
-					),
-				)
-				err = form.Run()
-				if err != nil {
-					log.Fatal("Selection cancelled")
-				}
+// newPipeline is setupPipeline with the config and authenticator given.
+func newPipeline(cfg *config.Config, authenticator *auth.Authenticator) *pipeline.Pipeline {
+	p := pipeline.New(cfg, newFitbitClient(cfg, authenticator), setupDestinations(cfg, authenticator), loadLedger())
+	p.Notify = setupNotify(cfg)
+	return p
+}
 
-				if selectedAction != "manual" {
-					// Find the selected activity object
-					id, _ := strconv.ParseInt(selectedAction, 10, 64)
-					for _, act := range filteredActivities {
-						if act.LogID == id {
-							selectedActivity = &act
-							break
-						}
-					}
+// setupFitbit is setupPipeline for commands that only read from Fitbit.
+func setupFitbit() *pipeline.Pipeline {
+	cfg, authenticator := loadAuth()
+	return pipeline.New(cfg, newFitbitClient(cfg, authenticator), nil, loadLedger())
+}
 
-					if selectedActivity != nil {
-						t, err := time.Parse("2006-01-02T15:04:05.000-07:00", selectedActivity.StartTime)
-						if err != nil {
-							log.Printf("Error parsing time: %v", err)
-							// Fallback to manual if parsing fails? Or just continue with manual
-							selectedAction = "manual"
-						} else {
-							*dateStr = t.Format("2006-01-02")
-							*startTimeStr = t.Format("15:04")
-							*durationMin = selectedActivity.Duration / 60000
-						}
-					}
-				}
-			} else {
-				fmt.Println("No suitable recent activities found.")
-				selectedAction = "manual"
-			}
-		} else {
+// setupDestinations builds the destinations listed in the config. Strava is
+// only authenticated if it is one of them.
+func setupDestinations(cfg *config.Config, authenticator *auth.Authenticator) []destination.Destination {
+	var dests []destination.Destination
+	for _, name := range cfg.Destinations {
+		switch name {
+		case "strava":
+			dests = append(dests, destination.NewStrava(newStravaClient(cfg, authenticator)))
+		case "intervals":
+			client := intervals.NewClient(loggingClient("intervals"), cfg.IntervalsAthleteID, cfg.IntervalsAPIKey)
+			dests = append(dests, destination.NewIntervals(client))
+		case "archive":
+			dests = append(dests, destination.NewArchive(cfg.ArchiveDir))
+		case "webdav":
+			path, err := destination.ParsePathTemplate(cfg.WebDAVPathTemplate)
 			if err != nil {
-				fmt.Printf("Error fetching recent activities: %v\n", err)
+				logging.Fatal("Invalid WEBDAV_PATH_TEMPLATE", "error", err)
 			}
-			selectedAction = "manual"
-		}
-
-		if selectedAction == "manual" {
-			// Manual Entry Form
-			if *dateStr == "" {
-				*dateStr = time.Now().Format("2006-01-02")
-			}
-			if *durationMin == 0 {
-				*durationMin = 60
-			}
-			durationStr := strconv.Itoa(*durationMin)
-
-			form := huh.NewForm(
-				huh.NewGroup(
-					huh.NewInput().
-						Title("Date").
-						Description("YYYY-MM-DD").
-						Value(dateStr).
-						Validate(func(str string) error {
-							_, err := time.Parse("2006-01-02", str)
-							return err
-						}),
-					huh.NewInput().
-						Title("Start Time").
-						Description("HH:mm").
-						Value(startTimeStr).
-						Validate(func(str string) error {
-							_, err := time.Parse("15:04", str)
-							return err
-						}),
-					huh.NewInput().
-						Title("Duration (minutes)").
-						Value(&durationStr).
-						Validate(func(str string) error {
-							_, err := strconv.Atoi(str)
-							return err
-						}),
-				),
-			)
-
-			err := form.Run()
+			client := webdav.NewClient(loggingClient("webdav"), cfg.WebDAVURL, cfg.WebDAVUsername, cfg.WebDAVPassword)
+			dests = append(dests, destination.NewWebDAV(client, path))
+		case "s3":
+			key, err := destination.ParsePathTemplate(cfg.S3KeyTemplate)
 			if err != nil {
-				log.Fatal("Input cancelled")
+				logging.Fatal("Invalid S3_KEY_TEMPLATE", "error", err)
 			}
-			*durationMin, _ = strconv.Atoi(durationStr)
-		}
-	} else {
-		// If non-interactive, set default date if missing
-		if *dateStr == "" {
-			*dateStr = time.Now().Format("2006-01-02")
-		}
-		// Set default duration if missing
-		if *durationMin == 0 {
-			*durationMin = 60
+			client := s3.NewClient(loggingClient("s3"), cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+			dests = append(dests, destination.NewS3(client, key))
+		default:
+			logging.Fatal("Unknown destination in DESTINATIONS (want strava, intervals, archive, webdav or s3)", "destination", name)
 		}
 	}
-
-	// 3. Metadata Calculation
-	start, err := time.Parse("15:04", *startTimeStr)
-	if err != nil {
-		log.Fatalf("Invalid start time format: %v", err)
+	if len(dests) == 0 {
+		logging.Fatal("No destinations configured in DESTINATIONS")
 	}
-	end := start.Add(time.Duration(*durationMin) * time.Minute)
-	endTimeStr := end.Format("15:04")
+	return dests
+}
 
-	fmt.Printf("Fetching heart rate data for %s from %s to %s...\n", *dateStr, *startTimeStr, endTimeStr)
+// loggingClient is the HTTP client for a destination without OAuth.
+func loggingClient(provider string) *http.Client {
+	return &http.Client{Timeout: time.Minute, Transport: logging.NewTransport(provider, nil)}
+}
 
-	// 4. Fetch Data
-	hrData, err := fitbitClient.FetchIntradayHeartRate(*dateStr, *startTimeStr, endTimeStr)
+func loadLedger() *ledger.Ledger {
+	book, err := ledger.Load()
 	if err != nil {
-		log.Fatalf("Failed to fetch Fitbit data: %v", err)
-	}
-	fmt.Printf("Retrieved %d heart rate samples.\n", len(hrData.ActivitiesHeartIntraday.Dataset))
-
-	if len(hrData.ActivitiesHeartIntraday.Dataset) == 0 {
-		log.Println("No data found for this period. Exiting.")
-		return
+		logging.Fatal("Failed to load sync ledger", "error", err)
 	}
+	return book
+}
 
-	// 4b. Fetch Activity Logs for Calories and Source
-	var totalCalories int
-	var activitySource *fitbit.ActivityLogSource
-	var activityName string = "Workout"
-
-	// If we selected an activity interactively, use its name as efficient default
-	if interactive && selectedActivity != nil {
-		activityName = selectedActivity.Name
+func loadAuth() (*config.Config, *auth.Authenticator) {
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal("Failed to load config", "error", err)
 	}
-
-	activityLogs, err := fitbitClient.GetActivityLogs(*dateStr)
+	tokenStore, err := auth.LoadTokens()
 	if err != nil {
-		log.Printf("Warning: Failed to fetch activity logs: %v\n", err)
-	} else {
-		// Find matching log
-		// Fitbit logs use "13:00" format. *startTimeStr is "HH:mm".
-		for _, logItem := range activityLogs.Activities {
-			// Simple match on start time. Could allow fuzzy matching later.
-			if logItem.StartTime == *startTimeStr {
-				totalCalories = logItem.Calories
-				// Use the source from the log if available
-				// (in interactive mode we could have passed it, but re-fetching here is consistent)
-				activitySource = &logItem.Source
-				activityName = logItem.Name
-				fmt.Printf("Found matching activity log: %s (Calories: %d)\n", logItem.Name, totalCalories)
-				break
-			}
-		}
+		logging.Fatal("Failed to load token store", "error", err)
 	}
+	authenticator := auth.NewAuthenticator(tokenStore)
+	// Only offer the browser flow to someone who can see the URL; from cron,
+	// a missing token fails with exitAuth instead of waiting forever.
+	authenticator.Interactive = isTerminal(os.Stderr)
+	return cfg, authenticator
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	// 5. Create FIT File
-	fitFilename := "workout.fit"
-	fmt.Println("Generating FIT file...")
-	if err := encoder.CreateFitFile(fitFilename, *dateStr, *startTimeStr, "", hrData, totalCalories, activitySource, activityName); err != nil {
-		log.Fatalf("Failed to create FIT file: %v", err)
+func fitbitOAuthConfig(cfg *config.Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.FitbitClientID,
+		ClientSecret: cfg.FitbitClientSecret,
+		RedirectURL:  "http://localhost:8080/callback",
+		Scopes:       []string{"heartrate", "activity", "profile", "location", "settings"},
+		Endpoint:     fitbitOAuth.Endpoint,
 	}
-	fmt.Println("FIT file created successfully.")
+}
 
-	// 6. Upload to Strava
-	if *dryRun {
-		fmt.Println("Dry run enabled. Skipping Strava upload.")
-		fmt.Printf("File saved to %s\n", fitFilename)
-		return
+func stravaOAuthConfig(cfg *config.Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.StravaClientID,
+		ClientSecret: cfg.StravaClientSecret,
+		RedirectURL:  "http://localhost:8080/callback",
+		Scopes:       []string{"activity:write", "activity:read_all"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://www.strava.com/oauth/mobile/authorize",
+			TokenURL: "https://www.strava.com/oauth/token",
+		},
 	}
+}
 
-	// Interactive Confirmation
-	if interactive {
-		var confirm bool
-		err := huh.NewConfirm().
-			Title("Ready to upload to Strava?").
-			Value(&confirm).
-			Run()
+func newFitbitClient(cfg *config.Config, authenticator *auth.Authenticator) *fitbit.Client {
+	return fitbit.NewClient(authenticator.GetClient(context.Background(), "fitbit", fitbitOAuthConfig(cfg)))
+}
 
-		if err != nil {
-			log.Fatal("Confirmation cancelled")
+func newStravaClient(cfg *config.Config, authenticator *auth.Authenticator) *strava.Client {
+	return strava.NewClient(authenticator.GetClient(context.Background(), "strava", stravaOAuthConfig(cfg)))
+}
+
+// buildActivity fetches and encodes a logged activity, or the window when
+// act is nil. GPS activities are forwarded as Fitbit's own TCX. The
+// selected and encoded hooks run on the way.
+func buildActivity(p *pipeline.Pipeline, act *fitbit.ActivityLog, win pipeline.Window, opts pipeline.Options, gps gpsFlags) (destination.Activity, error) {
+	selected, err := p.Selected(act, win)
+	if err != nil {
+		return destination.Activity{}, err
+	}
+	var built destination.Activity
+	if act != nil && act.HasGPS {
+		built, err = p.FetchGPS(*act, *gps.tcxHR, opts)
+	} else {
+		name := ""
+		if act != nil {
+			name = act.Name
 		}
-		if !confirm {
-			fmt.Println("Upload cancelled.")
-			return
+		var fetched *pipeline.Fetched
+		fetched, err = p.Fetch(win, name)
+		if err != nil {
+			return destination.Activity{}, err
 		}
+		built, err = p.Encode(fetched, opts)
 	}
-
-	fmt.Println("Uploading to Strava...")
-
-	// Determine default name based on time of day
-	hour := start.Hour()
-	var defaultName string
-	switch {
-	case hour >= 4 && hour < 12:
-		defaultName = "Morning workout ☀️"
-	case hour >= 12 && hour < 17:
-		defaultName = "Afternoon workout 💪"
-	case hour >= 17 && hour < 21:
-		defaultName = "Evening workout 🌙"
-	default:
-		defaultName = "Night workout 🌚"
+	if err != nil {
+		return destination.Activity{}, err
 	}
+	selected.Apply(&built)
+	return p.Encoded(built)
+}
 
-	// Create metadata
-	metadata := strava.ActivityMetadata{
-		Name: defaultName,
+// findActivity looks up an activity by log id among the recent ones.
+func findActivity(p *pipeline.Pipeline, logID int64) (*fitbit.ActivityLog, error) {
+	recent, err := p.Recent(100, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent activities: %w", err)
 	}
-	if totalCalories > 0 {
-		// metadata.Description = fmt.Sprintf("Imported from Fitbit. Total Calories: %d", totalCalories)
-		// If we found a named activity log, use its name
-		for _, logItem := range activityLogs.Activities {
-			if logItem.StartTime == *startTimeStr {
-				// If the log name is generic "Workout", keep our time-based name.
-				// Otherwise, use the specific name.
-				if logItem.Name != "Workout" && logItem.Name != "Activity" {
-					metadata.Name = logItem.Name
-				}
-				metadata.ExternalID = fmt.Sprintf("fitbit-%d", logItem.LogID)
-				break
-			}
+	for i := range recent {
+		if recent[i].LogID == logID {
+			return &recent[i], nil
 		}
 	}
+	return nil, fmt.Errorf("activity %d is not among the 100 most recent", logID)
+}
 
-	resp, err := stravaClient.UploadActivity(fitFilename, metadata)
-	if err != nil {
-		log.Fatalf("Failed to upload to Strava: %v", err)
+// reportError prints err for a command without -output and returns its
+// exit code.
+func reportError(err error) int {
+	if errors.Is(err, pipeline.ErrNoHeartRate) {
+		fmt.Println("No data found for this period.")
+		return exitNothingToDo
 	}
-	fmt.Printf("Upload successful! Response: %s\n", resp)
-
-	// Cleanup
-	// os.Remove(fitFilename)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitCodeFor(err)
 }
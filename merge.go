@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/encoder"
+	"fitbit-strava/pipeline"
+
+	"github.com/charmbracelet/huh"
+)
+
+// runMerge implements `fitbit-strava merge <file>`: it adds Fitbit heart rate
+// to a FIT or TCX file recorded by another device and uploads the result.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	offset := fs.Duration("offset", 0, "Shift Fitbit timestamps by this much to match the file's clock (e.g. 3s if Fitbit is 3 seconds behind)")
+	name := fs.String("name", "", "Activity name (default: Strava's own)")
+	dryRun := fs.Bool("dry-run", false, "Write the merged file but do not upload it")
+	yes := fs.Bool("yes", false, "Upload without asking for confirmation")
+	clean := newHRCleanFlags(fs)
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava merge [flags] <file.fit|file.tcx>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	path := fs.Arg(0)
+	res := activityResult{File: path, Name: *name}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report.failActivity(res, err)
+	}
+	isFIT := encoder.IsFIT(data)
+
+	start, end, err := encoder.Span(data)
+	if err != nil {
+		return report.failActivity(res, fmt.Errorf("failed to read %s: %v", path, err))
+	}
+	res.StartTime = start
+
+	p := setupPipeline()
+	report.notify = p.Notify
+
+	// Fitbit's clock is the one being shifted, so fetch its span.
+	fileStart := start
+	start, end = start.Add(-*offset).Local(), end.Add(-*offset).Local()
+	slog.Info("Fetching heart rate", "start", start, "end", end)
+	samples, err := p.FetchHeartRateSpan(start, end)
+	if err != nil {
+		return report.failActivity(res, fmt.Errorf("failed to fetch Fitbit heart rate: %w", err))
+	}
+	if len(samples) == 0 {
+		return report.failActivity(res, pipeline.ErrNoHeartRate)
+	}
+	slog.Info("Retrieved heart rate", "samples", len(samples))
+
+	// Clean as for a Fitbit activity of the file's sport.
+	samples = p.CleanSamples(samples, clean.pipelineOptions(), encoder.SportName(data))
+	for i := range samples {
+		samples[i].Time = samples[i].Time.Add(*offset)
+	}
+
+	var merged []byte
+	var count int
+	if isFIT {
+		merged, count, err = encoder.MergeFIT(data, samples)
+	} else {
+		merged, count, err = encoder.EnrichTCX(data, samples)
+	}
+	if err != nil {
+		return report.failActivity(res, fmt.Errorf("failed to merge heart rate: %v", err))
+	}
+	if count == 0 {
+		// Uploading would only duplicate the file without heart rate.
+		return report.failActivity(res, fmt.Errorf("no record without heart rate is within %s of a Fitbit sample; check -offset", encoder.MaxMatchOffset))
+	}
+	slog.Info("Added heart rate", "records", count)
+
+	ext := filepath.Ext(path)
+	if *dryRun {
+		res.File = strings.TrimSuffix(path, ext) + "-merged" + ext
+		if err := os.WriteFile(res.File, merged, 0644); err != nil {
+			return report.failActivity(res, fmt.Errorf("failed to write file: %v", err))
+		}
+		report.textf("Dry run enabled. Skipping upload.\n")
+		report.textf("File saved to %s\n", res.File)
+		res.Status = statusSaved
+		report.add(res)
+		return report.finish()
+	}
+
+	if !*yes {
+		var confirm bool
+		if err := huh.NewConfirm().Title(fmt.Sprintf("Ready to upload to %s?", destination.Names(p.Destinations))).Value(&confirm).Run(); err != nil || !confirm {
+			report.textf("Upload cancelled.\n")
+			res.Status = statusCancelled
+			report.add(res)
+			return report.finish()
+		}
+	}
+
+	act := destination.Activity{
+		Data:      merged,
+		Format:    strings.ToLower(strings.TrimPrefix(ext, ".")),
+		Name:      *name,
+		StartTime: fileStart,
+	}
+	res = res.uploaded(p.Upload(act))
+	if res.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", res.err)
+	}
+	report.add(res)
+	return report.finish()
+}
@@ -0,0 +1,153 @@
+// Package metrics counts what the long-running commands do and serves the
+// counts in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Activities counts activities by outcome: discovered (picked up to
+	// sync by a check, once each), synced, skipped or failed.
+	Activities = NewCounter("fitbit_strava_activities_total", "Activities by outcome: discovered, synced, skipped or failed.", "outcome")
+	// APIRequests counts HTTP requests by provider and status code, or
+	// "error" when there was no response.
+	APIRequests = NewCounter("fitbit_strava_api_requests_total", "API requests by provider and HTTP status.", "provider", "status")
+	// RateLimitRemaining is the last reported number of requests left.
+	RateLimitRemaining = NewGauge("fitbit_strava_rate_limit_remaining", "Requests left before the provider's rate limit, as last reported.", "provider")
+	// TokenRefreshes counts refreshed OAuth access tokens.
+	TokenRefreshes = NewCounter("fitbit_strava_token_refreshes_total", "OAuth access tokens refreshed.", "provider")
+	// LastSuccess is the Unix time a check for new activities last
+	// completed without errors.
+	LastSuccess = NewGauge("fitbit_strava_last_success_timestamp_seconds", "When a check for new activities last completed without errors.")
+)
+
+func init() {
+	// Start the outcomes at zero, so rates work from the first scrape.
+	for _, outcome := range []string{"discovered", "synced", "skipped", "failed"} {
+		Activities.Add(0, outcome)
+	}
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Vec
+)
+
+// Vec is a counter or gauge, with one value per combination of label
+// values.
+type Vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu sync.Mutex
+	// values are keyed by the label values joined with a zero byte.
+	values map[string]float64
+}
+
+// NewCounter registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, kind: "counter", labels: labels, values: make(map[string]float64)})
+}
+
+// NewGauge registers a gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Vec {
+	return register(&Vec{name: name, help: help, kind: "gauge", labels: labels, values: make(map[string]float64)})
+}
+
+func register(v *Vec) *Vec {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, v)
+	return v
+}
+
+// Inc adds one to the value for the label values.
+func (v *Vec) Inc(values ...string) { v.Add(1, values...) }
+
+// Add adds delta to the value for the label values.
+func (v *Vec) Add(delta float64, values ...string) {
+	key := v.key(values)
+	v.mu.Lock()
+	v.values[key] += delta
+	v.mu.Unlock()
+}
+
+// Set sets the value for the label values; it is meant for gauges.
+func (v *Vec) Set(x float64, values ...string) {
+	key := v.key(values)
+	v.mu.Lock()
+	v.values[key] = x
+	v.mu.Unlock()
+}
+
+func (v *Vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func (v *Vec) write(w io.Writer) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	for _, key := range keys {
+		b.WriteString(v.name)
+		if len(v.labels) > 0 {
+			b.WriteByte('{')
+			for i, value := range strings.Split(key, "\x00") {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(&b, "%s=\"%s\"", v.labels[i], escapeLabel(value))
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(v.values[key], 'g', -1, 64))
+	}
+	v.mu.Unlock()
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// Write writes every metric in the Prometheus text format.
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	vecs := append([]*Vec(nil), registry...)
+	registryMu.Unlock()
+	sort.Slice(vecs, func(i, j int) bool { return vecs[i].name < vecs[j].name })
+
+	for _, v := range vecs {
+		if err := v.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics to a Prometheus scrape.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
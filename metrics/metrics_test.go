@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	// The outcomes are there before anything happens.
+	before := scrape(t)
+	for _, outcome := range []string{"discovered", "synced", "skipped", "failed"} {
+		if want := `fitbit_strava_activities_total{outcome="` + outcome + `"} 0`; !strings.Contains(before, want) {
+			t.Errorf("missing %s in\n%s", want, before)
+		}
+	}
+
+	Activities.Inc("synced")
+	Activities.Inc("synced")
+	APIRequests.Inc("fitbit", "429")
+	RateLimitRemaining.Set(10, "strava")
+	RateLimitRemaining.Set(7, "strava")
+	LastSuccess.Set(1760000000)
+
+	got := scrape(t)
+	for _, want := range []string{
+		"# TYPE fitbit_strava_activities_total counter\n",
+		`fitbit_strava_activities_total{outcome="synced"} 2` + "\n",
+		`fitbit_strava_api_requests_total{provider="fitbit",status="429"} 1` + "\n",
+		"# TYPE fitbit_strava_rate_limit_remaining gauge\n",
+		`fitbit_strava_rate_limit_remaining{provider="strava"} 7` + "\n",
+		"fitbit_strava_last_success_timestamp_seconds 1.76e+09\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	// Metrics are sorted by name.
+	if strings.Index(got, "fitbit_strava_activities_total") > strings.Index(got, "fitbit_strava_api_requests_total") {
+		t.Errorf("metrics out of order:\n%s", got)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	v := NewCounter("test_escaped_total", "Labels that need escaping.", "value")
+	v.Inc("a \"quoted\"\\path\n")
+	if want := `test_escaped_total{value="a \"quoted\"\\path\n"} 1`; !strings.Contains(scrape(t), want) {
+		t.Errorf("missing %s", want)
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a missing label value")
+		}
+	}()
+	APIRequests.Inc("fitbit")
+}
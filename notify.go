@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+
+	"fitbit-strava/config"
+	"fitbit-strava/notify"
+	"fitbit-strava/pipeline"
+)
+
+// setupNotify builds the notifiers configured in .env, or nil if there are
+// none.
+func setupNotify(cfg *config.Config) *notify.Dispatcher {
+	var notifiers []notify.Notifier
+	if cfg.NotifyWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhook(loggingClient("webhook"), cfg.NotifyWebhookURL))
+	}
+	if cfg.NotifyNtfyURL != "" {
+		notifiers = append(notifiers, notify.NewNtfy(loggingClient("ntfy"), cfg.NotifyNtfyURL, cfg.NotifyNtfyToken))
+	}
+	if cfg.NotifySMTPAddr != "" {
+		notifiers = append(notifiers, notify.NewEmail(cfg.NotifySMTPAddr, cfg.NotifySMTPUsername, cfg.NotifySMTPPassword, cfg.NotifyEmailFrom, cfg.NotifyEmailTo))
+	}
+	if cfg.NotifyExec != "" {
+		notifiers = append(notifiers, notify.NewExec(cfg.NotifyExec))
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return &notify.Dispatcher{Notifiers: notifiers, FailuresOnly: cfg.NotifyOn == "failure"}
+}
+
+// activityEvent describes the outcome for one activity. It reports false
+// for results that aren't worth telling: dry runs, saved files, declined
+// uploads, activities a hook skipped, and errors that aren't about an
+// activity.
+func activityEvent(command string, res activityResult) (notify.Event, bool) {
+	switch res.Status {
+	case statusUploaded, statusPartial, statusFailed, statusSkipped:
+	default:
+		return notify.Event{}, false
+	}
+	if !hasActivity(res) || skippedByHook(res) {
+		return notify.Event{}, false
+	}
+	e := notify.Event{
+		Type:      "activity",
+		Command:   command,
+		Status:    res.Status,
+		LogID:     res.LogID,
+		Name:      res.Name,
+		StartTime: res.StartTime,
+		Error:     res.Error,
+	}
+	if e.Name == "" {
+		e.Name = res.File
+	}
+	if d, ok := res.Destinations["strava"]; ok && d.URL != "" {
+		e.URL = d.URL
+	} else {
+		for _, d := range res.Destinations {
+			if d.URL != "" {
+				e.URL = d.URL
+				break
+			}
+		}
+	}
+	return e, true
+}
+
+// runEvent summarizes a run from its results, which may include an error
+// that ended it. It reports false for a run that uploaded nothing and had
+// nothing go wrong.
+func runEvent(command string, results []activityResult) (notify.Event, bool) {
+	e := notify.Event{Type: "run", Command: command}
+	partial, cutShort := 0, false
+	for _, res := range results {
+		if skippedByHook(res) {
+			continue
+		}
+		if !hasActivity(res) {
+			if res.Status == statusFailed {
+				cutShort = true
+				e.Error = res.Error
+			}
+			continue
+		}
+		switch res.Status {
+		case statusUploaded:
+			e.Synced++
+		case statusSkipped:
+			e.Skipped++
+		case statusPartial:
+			partial++
+			e.Failed++
+		case statusFailed:
+			e.Failed++
+		}
+		if e.Error == "" && res.Error != "" && res.Status != statusSkipped {
+			e.Error = res.Error
+		}
+	}
+	switch {
+	case !cutShort && e.Synced == 0 && e.Skipped == 0 && e.Failed == 0:
+		return e, false
+	case !cutShort && e.Failed == 0:
+		e.Status = "ok"
+	case e.Synced == 0 && partial == 0:
+		e.Status = "failed"
+	default:
+		e.Status = "partial"
+	}
+	return e, true
+}
+
+// hasActivity reports whether res is about an activity rather than an
+// error that ended the command before it got to one.
+func hasActivity(res activityResult) bool {
+	return res.LogID != 0 || res.Name != "" || res.File != "" || !res.StartTime.IsZero()
+}
+
+// skippedByHook reports whether res was skipped by the user's own hook,
+// which would otherwise be news at every check.
+func skippedByHook(res activityResult) bool {
+	return errors.Is(res.err, pipeline.ErrSkipped)
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session is what a fake SMTP server was told in one session.
+type session struct {
+	commands []string
+	data     string
+}
+
+// fakeSMTP accepts a single SMTP session on localhost, offering PLAIN auth
+// but not STARTTLS, and sends what it was told on the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan session) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan session, 1)
+	go func() {
+		var s session
+		defer func() { done <- s }()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP fake")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			s.commands = append(s.commands, line)
+			verb := strings.ToUpper(strings.Fields(line)[0])
+			switch verb {
+			case "EHLO":
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				tp.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				lines, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				s.data = strings.Join(lines, "\n")
+				tp.PrintfLine("250 OK queued")
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestEmail(t *testing.T) {
+	addr, done := fakeSMTP(t)
+	m := NewEmail(addr, "alice", "secret", "fitbit-strava@example.com", []string{"alice@example.com", "bob@example.com"})
+	if err := m.Notify(context.Background(), uploaded); err != nil {
+		t.Fatal(err)
+	}
+	s := <-done
+
+	want := []string{
+		"AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00alice\x00secret")),
+		"MAIL FROM:<fitbit-strava@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"RCPT TO:<bob@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	if len(s.commands) != len(want)+1 || !strings.HasPrefix(s.commands[0], "EHLO ") {
+		t.Fatalf("commands %q", s.commands)
+	}
+	for i, cmd := range want {
+		// net/smtp may add parameters such as BODY=8BITMIME.
+		if got := s.commands[i+1]; !strings.HasPrefix(got, cmd) {
+			t.Errorf("command %d = %q, want %q", i+1, got, cmd)
+		}
+	}
+
+	header, body, _ := strings.Cut(s.data, "\n\n")
+	for _, h := range []string{
+		"From: fitbit-strava@example.com",
+		"To: alice@example.com, bob@example.com",
+		"Subject: =?utf-8?q?Synced_Evening_workout_=F0=9F=8C=99?=",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(header, h+"\n") {
+			t.Errorf("header lacks %q:\n%s", h, header)
+		}
+	}
+	if want := uploaded.Message(); body != want {
+		t.Errorf("body %q, want %q", body, want)
+	}
+}
+
+func TestEmailRejected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		w := bufio.NewWriter(conn)
+		r := textproto.NewReader(bufio.NewReader(conn))
+		w.WriteString("220 localhost ESMTP fake\r\n")
+		w.Flush()
+		for {
+			line, err := r.ReadLine()
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "EHLO") {
+				w.WriteString("250 localhost\r\n")
+			} else {
+				w.WriteString("550 5.7.1 Relaying denied\r\n")
+			}
+			w.Flush()
+		}
+	}()
+
+	err = NewEmail(ln.Addr().String(), "", "", "a@example.com", []string{"b@example.com"}).Notify(context.Background(), uploaded)
+	if err == nil || !strings.Contains(err.Error(), "Relaying denied") {
+		t.Errorf("Notify = %v, want the server's rejection", err)
+	}
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Exec runs a local program for each event, with the event as JSON on
+// stdin and its type and status in FITBIT_STRAVA_EVENT and
+// FITBIT_STRAVA_STATUS.
+type Exec struct {
+	Path string
+}
+
+func NewExec(path string) *Exec {
+	return &Exec{Path: path}
+}
+
+func (x *Exec) Name() string { return "exec" }
+
+func (x *Exec) Notify(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, x.Path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "FITBIT_STRAVA_EVENT="+e.Type, "FITBIT_STRAVA_STATUS="+e.Status)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", x.Path, err, strings.TrimSpace(string(out)))
+	}
+	if len(out) > 0 {
+		slog.Debug("Notification hook output", "path", x.Path, "output", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// script writes an executable shell script to a temporary directory.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExec(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	path := script(t, `echo "$FITBIT_STRAVA_EVENT $FITBIT_STRAVA_STATUS" > "$OUT"; cat >> "$OUT"`)
+	t.Setenv("OUT", out)
+
+	if err := NewExec(path).Notify(context.Background(), failedRun); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, stdin, _ := strings.Cut(string(data), "\n")
+	if env != "run failed" {
+		t.Errorf("environment %q, want %q", env, "run failed")
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(stdin), &got); err != nil {
+		t.Fatalf("stdin %q: %v", stdin, err)
+	}
+	if got != failedRun {
+		t.Errorf("stdin %+v, want %+v", got, failedRun)
+	}
+}
+
+func TestExecFailure(t *testing.T) {
+	path := script(t, "echo 'no route to host' >&2; exit 3\n")
+	err := NewExec(path).Notify(context.Background(), uploaded)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "no route to host") {
+		t.Errorf("Notify = %v, want the exit status and output", err)
+	}
+}
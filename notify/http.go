@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Webhook POSTs each event as JSON to a URL.
+type Webhook struct {
+	Client *http.Client
+	URL    string
+}
+
+func NewWebhook(client *http.Client, url string) *Webhook {
+	return &Webhook{Client: client, URL: url}
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(w.Client, req)
+}
+
+// Ntfy publishes each event to an ntfy topic, given as its URL, e.g.
+// https://ntfy.sh/my-topic.
+type Ntfy struct {
+	Client *http.Client
+	URL    string
+	// Token is an access token for a protected topic; empty for none.
+	Token string
+}
+
+func NewNtfy(client *http.Client, url, token string) *Ntfy {
+	return &Ntfy{Client: client, URL: url, Token: token}
+}
+
+func (n *Ntfy) Name() string { return "ntfy" }
+
+func (n *Ntfy) Notify(ctx context.Context, e Event) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, strings.NewReader(e.Message()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	// Headers are ASCII; ntfy decodes RFC 2047 words.
+	req.Header.Set("Title", mime.BEncoding.Encode("utf-8", e.Title()))
+	if e.Failure() {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	} else {
+		req.Header.Set("Tags", "white_check_mark")
+	}
+	if e.URL != "" {
+		req.Header.Set("Click", e.URL)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(n.Client, req)
+}
+
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("status %s, body %s", resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uploaded = Event{
+	Type:      "activity",
+	Command:   "sync",
+	Status:    "uploaded",
+	Time:      time.Date(2024, 5, 1, 19, 0, 0, 0, time.UTC),
+	LogID:     1234,
+	Name:      "Evening workout 🌙",
+	StartTime: time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC),
+	URL:       "https://www.strava.com/activities/42",
+}
+
+var failedRun = Event{Type: "run", Command: "daemon", Status: "failed", Failed: 2, Error: "upload failed: strava: rate limited"}
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.Client(), srv.URL).Notify(context.Background(), uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(uploaded.Time) || !got.StartTime.Equal(uploaded.StartTime) {
+		t.Errorf("times %v, %v", got.Time, got.StartTime)
+	}
+	got.Time, got.StartTime = uploaded.Time, uploaded.StartTime
+	if got != uploaded {
+		t.Errorf("posted %+v, want %+v", got, uploaded)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	err := NewWebhook(srv.Client(), srv.URL).Notify(context.Background(), uploaded)
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such hook") {
+		t.Errorf("Notify = %v, want the status and body", err)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	for _, tc := range []struct {
+		event    Event
+		token    string
+		title    string
+		priority string
+		tags     string
+		click    string
+	}{
+		{uploaded, "", "Synced Evening workout 🌙", "", "white_check_mark", uploaded.URL},
+		{failedRun, "tk_secret", "fitbit-strava daemon failed", "high", "warning", ""},
+	} {
+		var header http.Header
+		var body string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+		}))
+
+		err := NewNtfy(srv.Client(), srv.URL+"/my-topic", tc.token).Notify(context.Background(), tc.event)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		title, err := new(mime.WordDecoder).DecodeHeader(header.Get("Title"))
+		if err != nil || title != tc.title {
+			t.Errorf("Title %q (%v), want %q", title, err, tc.title)
+		}
+		for name, want := range map[string]string{"Priority": tc.priority, "Tags": tc.tags, "Click": tc.click} {
+			if got := header.Get(name); got != want {
+				t.Errorf("%s = %q, want %q", name, got, want)
+			}
+		}
+		auth := ""
+		if tc.token != "" {
+			auth = "Bearer " + tc.token
+		}
+		if got := header.Get("Authorization"); got != auth {
+			t.Errorf("Authorization = %q, want %q", got, auth)
+		}
+		if body != tc.event.Message() {
+			t.Errorf("body %q, want %q", body, tc.event.Message())
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package notify tells someone how a sync went, per activity and per run,
+// over a webhook, ntfy, email or a local script.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// sendTimeout bounds each notifier, so an unreachable server doesn't hold
+// up a sync.
+const sendTimeout = 30 * time.Second
+
+// Event is what happened to one activity, or in one run of a command.
+type Event struct {
+	// Type is "activity" or "run".
+	Type string `json:"type"`
+	// Command is the fitbit-strava command that ran, e.g. "sync".
+	Command string `json:"command"`
+	// Status of an activity is uploaded, partial, failed or skipped; of a
+	// run, ok, partial or failed.
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+
+	LogID     int64     `json:"fitbit_log_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	StartTime time.Time `json:"start_time,omitzero"`
+	// URL links to the uploaded activity, on Strava if it is a destination.
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	// The activities of a run, by outcome.
+	Synced  int `json:"synced,omitempty"`
+	Skipped int `json:"skipped,omitempty"`
+	Failed  int `json:"failed,omitempty"`
+}
+
+// Failure reports whether the event is about something going wrong.
+func (e Event) Failure() bool {
+	return e.Status == "failed" || e.Status == "partial"
+}
+
+// Title is a one-line summary, e.g. for an email subject.
+func (e Event) Title() string {
+	if e.Type == "run" {
+		switch e.Status {
+		case "failed":
+			return fmt.Sprintf("fitbit-strava %s failed", e.Command)
+		case "partial":
+			return fmt.Sprintf("fitbit-strava %s partly failed", e.Command)
+		}
+		return fmt.Sprintf("fitbit-strava %s synced %d %s", e.Command, e.Synced, plural(e.Synced, "activity", "activities"))
+	}
+	switch e.Status {
+	case "uploaded":
+		return "Synced " + e.Name
+	case "partial":
+		return "Partly synced " + e.Name
+	case "skipped":
+		return "Skipped " + e.Name
+	}
+	return "Failed to sync " + e.Name
+}
+
+// Message is the body of a notification for people.
+func (e Event) Message() string {
+	var lines []string
+	if e.Type == "run" {
+		if e.Synced+e.Skipped+e.Failed > 0 {
+			lines = append(lines, fmt.Sprintf("Synced %d, skipped %d, failed %d.", e.Synced, e.Skipped, e.Failed))
+		}
+	} else if !e.StartTime.IsZero() {
+		lines = append(lines, fmt.Sprintf("%s, started %s", e.Name, e.StartTime.Format("2006-01-02 15:04")))
+	}
+	if e.URL != "" {
+		lines = append(lines, e.URL)
+	}
+	if e.Error != "" {
+		lines = append(lines, "Error: "+e.Error)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// Notifier delivers events somewhere.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, e Event) error
+}
+
+// Dispatcher sends events to every notifier. A nil Dispatcher sends
+// nothing.
+type Dispatcher struct {
+	Notifiers []Notifier
+	// FailuresOnly drops events about successes.
+	FailuresOnly bool
+}
+
+// Send tells every notifier about e. Failures are logged rather than
+// returned: a notification going astray shouldn't fail the sync.
+func (d *Dispatcher) Send(e Event) {
+	if d == nil || (d.FailuresOnly && !e.Failure()) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, n := range d.Notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := n.Notify(ctx, e); err != nil {
+			slog.Warn("Failed to send notification", "notifier", n.Name(), "error", err)
+		}
+		cancel()
+	}
+}
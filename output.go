@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"fitbit-strava/auth"
+	"fitbit-strava/destination"
+	"fitbit-strava/notify"
+	"fitbit-strava/pipeline"
+)
+
+// Exit codes, so scripts can tell what happened without parsing output.
+const (
+	exitOK          = 0
+	exitFailure     = 1 // everything attempted failed
+	exitUsage       = 2
+	exitNothingToDo = 3 // nothing needed syncing, or no heart rate was found
+	exitPartial     = 4 // some activities or destinations failed
+	exitAuth        = 5 // a token is missing or was revoked; run `fitbit-strava auth`
+	exitRateLimited = 6 // an API's rate limit was reached; try again later
+)
+
+// Statuses of an activityResult.
+const (
+	statusUploaded  = "uploaded"  // every destination succeeded
+	statusPartial   = "partial"   // some destinations failed
+	statusFailed    = "failed"    // nothing was uploaded or saved
+	statusSkipped   = "skipped"   // no heart rate for the activity, or a hook skipped it
+	statusSaved     = "saved"     // written to File instead of uploaded
+	statusPending   = "pending"   // would be synced, with -dry-run
+	statusCancelled = "cancelled" // declined at the confirmation prompt
+)
+
+// activityResult is what a command did with one activity. With -output json
+// each is printed as a line of JSON.
+type activityResult struct {
+	LogID     int64     `json:"fitbit_log_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	StartTime time.Time `json:"start_time,omitzero"`
+	// File is the file written or uploaded from disk.
+	File             string `json:"file,omitempty"`
+	Status           string `json:"status"`
+	UploadID         string `json:"upload_id,omitempty"`
+	StravaActivityID int64  `json:"strava_activity_id,omitempty"`
+	// Destinations are keyed by destination name.
+	Destinations map[string]destinationResult `json:"destinations,omitempty"`
+	Error        string                       `json:"error,omitempty"`
+
+	err error
+}
+
+type destinationResult struct {
+	ID       string `json:"id,omitempty"`
+	UploadID string `json:"upload_id,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// failed marks res as failed with err, or skipped if there was no heart
+// rate or a hook skipped it.
+func (res activityResult) failed(err error) activityResult {
+	res.Status = statusFailed
+	if errors.Is(err, pipeline.ErrNoHeartRate) || errors.Is(err, pipeline.ErrSkipped) {
+		res.Status = statusSkipped
+	}
+	res.Error = err.Error()
+	res.err = err
+	return res
+}
+
+// uploaded fills in res from the outcomes and error of Pipeline.Upload.
+func (res activityResult) uploaded(outcomes []destination.Outcome, err error) activityResult {
+	res.Destinations = make(map[string]destinationResult, len(outcomes))
+	succeeded := 0
+	for _, o := range outcomes {
+		d := destinationResult{ID: o.Result.ID, UploadID: o.Result.UploadID, URL: o.Result.URL}
+		if o.Err != nil {
+			d.Error = o.Err.Error()
+		} else {
+			succeeded++
+		}
+		res.Destinations[o.Destination] = d
+		if o.Destination == "strava" {
+			res.UploadID = o.Result.UploadID
+			res.StravaActivityID, _ = strconv.ParseInt(o.Result.ID, 10, 64)
+		}
+	}
+	if err == nil {
+		res.Status = statusUploaded
+		return res
+	}
+	res = res.failed(err)
+	if succeeded > 0 {
+		res.Status = statusPartial
+	}
+	return res
+}
+
+// reporter collects a command's results and turns them into its output and
+// exit code.
+type reporter struct {
+	format  *string
+	command string
+	results []activityResult
+	// notify, if set, is told about each activity and the run.
+	notify *notify.Dispatcher
+}
+
+// newReporter adds the -output flag to fs.
+func newReporter(fs *flag.FlagSet) *reporter {
+	return &reporter{
+		format:  fs.String("output", "text", "Output format: text, or json for a line of JSON per activity on stdout"),
+		command: fs.Name(),
+	}
+}
+
+// check validates -output once the flags are parsed.
+func (r *reporter) check() error {
+	return checkOutput(*r.format)
+}
+
+func (r *reporter) json() bool { return *r.format == "json" }
+
+// textf prints a result line for people. It is dropped with -output json.
+func (r *reporter) textf(format string, args ...any) {
+	if !r.json() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// add records res, printing it with -output json.
+func (r *reporter) add(res activityResult) {
+	r.results = append(r.results, res)
+	if e, ok := activityEvent(r.command, res); ok {
+		r.notify.Send(e)
+	}
+	if r.json() {
+		out, err := json.Marshal(res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Println(string(out))
+	}
+}
+
+// outputFlag adds -output to a command that prints a single table or
+// report; with json it prints what describes.
+func outputFlag(fs *flag.FlagSet, describes string) *string {
+	return fs.String("output", "text", "Output format: text, or json for "+describes)
+}
+
+// checkOutput validates an -output flag once the flags are parsed.
+func checkOutput(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid -output %q (want text or json)", format)
+	}
+	return nil
+}
+
+// printJSON prints v as indented JSON on stdout.
+func printJSON(v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// fail reports an error that ended the command and returns the exit code.
+func (r *reporter) fail(err error) int {
+	return r.failActivity(activityResult{}, err)
+}
+
+// failActivity is fail for an error with the activity res.
+func (r *reporter) failActivity(res activityResult, err error) int {
+	res = res.failed(err)
+	if !r.json() {
+		switch {
+		case errors.Is(err, pipeline.ErrNoHeartRate):
+			fmt.Println("No data found for this period.")
+		case res.Status == statusSkipped:
+			fmt.Printf("Skipped: %v\n", err)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	r.add(res)
+	return r.finish()
+}
+
+// finish ends the command: it sends the run's notification and returns the
+// exit code.
+func (r *reporter) finish() int {
+	if e, ok := runEvent(r.command, r.results); ok {
+		r.notify.Send(e)
+	}
+	return r.exitCode()
+}
+
+// exitCode summarizes the results. Missing or revoked authorization and rate
+// limits come first, as retrying won't help until they're dealt with.
+func (r *reporter) exitCode() int {
+	succeeded, failed := 0, 0
+	for _, res := range r.results {
+		if code := exitCodeFor(res.err); code == exitAuth || code == exitRateLimited {
+			return code
+		}
+		switch res.Status {
+		case statusUploaded, statusSaved, statusPending:
+			succeeded++
+		case statusPartial:
+			succeeded++
+			failed++
+		case statusFailed:
+			failed++
+		}
+	}
+	switch {
+	case failed == 0 && succeeded == 0:
+		return exitNothingToDo
+	case failed == 0:
+		return exitOK
+	case succeeded == 0:
+		return exitFailure
+	default:
+		return exitPartial
+	}
+}
+
+// apiError is implemented by the Fitbit and Strava clients' errors.
+type apiError interface {
+	Unauthorized() bool
+	RateLimited() bool
+}
+
+// exitCodeFor classifies an error that isn't tied to a result.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, auth.ErrAuthRequired) {
+		return exitAuth
+	}
+	var apiErr apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Unauthorized():
+			return exitAuth
+		case apiErr.RateLimited():
+			return exitRateLimited
+		}
+	}
+	if errors.Is(err, pipeline.ErrNoHeartRate) || errors.Is(err, pipeline.ErrSkipped) {
+		return exitNothingToDo
+	}
+	return exitFailure
+}
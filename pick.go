@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/pipeline"
+
+	"github.com/charmbracelet/huh"
+	"github.com/dustin/go-humanize"
+)
+
+// runPick implements `fitbit-strava pick`: choose one of the recent Fitbit
+// activities, or enter a time range, and upload it after confirmation.
+// Given -start, it skips the prompts.
+func runPick(args []string) int {
+	fs := flag.NewFlagSet("pick", flag.ExitOnError)
+	window := newWindowFlags(fs)
+	encode := newEncodeFlags(fs)
+	gps := newGPSFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Generate the activity file but do not upload it")
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava pick [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	opts, err := encode.options()
+	if err != nil {
+		return report.fail(err)
+	}
+
+	p := setupPipeline()
+	report.notify = p.Notify
+
+	interactive := !window.set()
+	var selected *fitbit.ActivityLog
+	if interactive {
+		selected, err = pickActivity(p, *gps.include)
+		if err != nil {
+			return report.fail(err)
+		}
+		if selected == nil {
+			if err := promptWindow(window); err != nil {
+				return report.fail(err)
+			}
+		}
+	}
+
+	var win pipeline.Window
+	if selected != nil {
+		win, err = pipeline.WindowFor(*selected)
+	} else {
+		win, err = window.window()
+	}
+	if err != nil {
+		return report.fail(err)
+	}
+
+	res := activityResult{StartTime: win.Start}
+	if selected != nil {
+		res.LogID, res.Name = selected.LogID, selected.Name
+	}
+	act, err := buildActivity(p, selected, win, opts, gps)
+	if err != nil {
+		return report.failActivity(res, err)
+	}
+	res.Name = act.Name
+
+	if *dryRun {
+		filename := "workout." + act.Format
+		if err := os.WriteFile(filename, act.Data, 0644); err != nil {
+			return report.failActivity(res, fmt.Errorf("failed to write file: %v", err))
+		}
+		report.textf("Dry run enabled. Skipping upload.\n")
+		report.textf("File saved to %s\n", filename)
+		if act.Format == string(encoder.FormatFIT) {
+			report.textf("Run `fitbit-strava inspect %s` to check it.\n", filename)
+		}
+		res.File, res.Status = filename, statusSaved
+		report.add(res)
+		return report.finish()
+	}
+
+	if interactive {
+		var confirm bool
+		err := huh.NewConfirm().
+			Title(fmt.Sprintf("Ready to upload to %s?", destination.Names(p.Destinations))).
+			Value(&confirm).
+			Run()
+		if err != nil {
+			return report.fail(fmt.Errorf("confirmation cancelled"))
+		}
+		if !confirm {
+			report.textf("Upload cancelled.\n")
+			res.Status = statusCancelled
+			report.add(res)
+			return report.finish()
+		}
+	}
+
+	res = res.uploaded(p.Upload(act))
+	if res.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", res.err)
+	}
+	report.add(res)
+	return report.finish()
+}
+
+// pickActivity lets the user choose a recent activity. It returns nil for
+// manual entry, or when there is nothing to choose from.
+func pickActivity(p *pipeline.Pipeline, includeGPS bool) (*fitbit.ActivityLog, error) {
+	recent, err := p.Recent(15, includeGPS)
+	if err != nil {
+		slog.Warn("Failed to fetch recent activities", "error", err)
+		return nil, nil
+	}
+	if len(recent) == 0 {
+		slog.Info("No suitable recent activities found")
+		return nil, nil
+	}
+
+	options := make([]huh.Option[string], 0, len(recent)+1)
+	for _, act := range recent {
+		t, _ := pipeline.StartTime(act)
+		// e.g., "Strength Training - 2 hours ago (13:00) [45m, 304 cal]"
+		label := fmt.Sprintf("%s - %s (%s) [%dm, %d cal]", act.Name, humanize.Time(t), t.Format("15:04"), act.Duration/60000, act.Calories)
+		if act.HasGPS {
+			label += " [GPS]"
+		}
+		if p.Synced(act) {
+			label += " [synced]"
+		} else if p.Skipped(act) != "" {
+			label += " [skipped]"
+		}
+		options = append(options, huh.NewOption(label, strconv.FormatInt(act.LogID, 10)))
+	}
+	options = append(options, huh.NewOption("Manual Entry", "manual"))
+
+	var choice string
+	err = huh.NewSelect[string]().
+		Title("Select Fitbit Activity").
+		Options(options...).
+		Value(&choice).
+		Run()
+	if err != nil {
+		return nil, fmt.Errorf("selection cancelled")
+	}
+	if choice == "manual" {
+		return nil, nil
+	}
+
+	id, _ := strconv.ParseInt(choice, 10, 64)
+	for i := range recent {
+		if recent[i].LogID == id {
+			if _, err := pipeline.StartTime(recent[i]); err != nil {
+				slog.Warn("Failed to parse start time", "error", err)
+				return nil, nil
+			}
+			return &recent[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// promptWindow asks for a date, start time and duration, prefilled from the
+// flags.
+func promptWindow(f windowFlags) error {
+	if *f.date == "" {
+		*f.date = time.Now().Format("2006-01-02")
+	}
+	durationStr := strconv.Itoa(*f.duration)
+
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Date").
+				Description("YYYY-MM-DD").
+				Value(f.date).
+				Validate(func(str string) error {
+					_, err := time.Parse("2006-01-02", str)
+					return err
+				}),
+			huh.NewInput().
+				Title("Start Time").
+				Description("HH:mm").
+				Value(f.start).
+				Validate(func(str string) error {
+					_, err := time.Parse("15:04", str)
+					return err
+				}),
+			huh.NewInput().
+				Title("Duration (minutes)").
+				Value(&durationStr).
+				Validate(func(str string) error {
+					_, err := strconv.Atoi(str)
+					return err
+				}),
+		),
+	).Run()
+	if err != nil {
+		return fmt.Errorf("input cancelled")
+	}
+	*f.duration, _ = strconv.Atoi(durationStr)
+	return nil
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/encoder"
+)
+
+// Options configures encoding.
+type Options struct {
+	Format encoder.Format
+	Laps   encoder.LapOptions
+	// Clean returns the heart rate cleaning for an activity type, or nil to
+	// leave heart rate as recorded. A nil Clean disables cleaning.
+	Clean func(activityName string) *encoder.CleanOptions
+}
+
+// Encode builds the activity file for fetched data and describes it for
+// upload. The name comes from the activity log unless it is generic, in
+// which case the activity is named by time of day.
+func (p *Pipeline) Encode(f *Fetched, opts Options) (destination.Activity, error) {
+	format := opts.Format
+	if format == "" {
+		format = encoder.FormatFIT
+	}
+
+	device, err := WorkoutDevice(f.source(), f.Device, p.Config)
+	if err != nil {
+		return destination.Activity{}, fmt.Errorf("invalid device override: %v", err)
+	}
+
+	var totalCalories int
+	if f.Log != nil {
+		totalCalories = f.Log.Calories
+	}
+	encOpts := encoder.Options{Format: format, Laps: opts.Laps}
+	if totalCalories == 0 && f.Profile != nil {
+		encOpts.Profile = &encoder.Profile{
+			Age:      f.Profile.Age,
+			WeightKg: f.Profile.Weight,
+			Sex:      strings.ToLower(f.Profile.Gender),
+		}
+	}
+
+	p.Log.Info("Generating file", "format", format)
+	workout, err := BuildWorkout(f.Window.Date(), f.HeartRate, f.Series, totalCalories, device, f.Name)
+	if err != nil {
+		return destination.Activity{}, fmt.Errorf("failed to build workout: %v", err)
+	}
+	workout.Samples = p.CleanSamples(workout.Samples, opts, f.Name)
+
+	var data bytes.Buffer
+	if err := encoder.Encode(&data, workout, encOpts); err != nil {
+		return destination.Activity{}, fmt.Errorf("failed to create %s file: %v", strings.ToUpper(string(format)), err)
+	}
+	p.Log.Info("File created", "format", format, "bytes", data.Len())
+
+	act := destination.Activity{
+		Data:      data.Bytes(),
+		Format:    string(format),
+		Name:      DefaultActivityName(f.Window.Start),
+		Sport:     f.Name,
+		StartTime: f.Window.Start,
+	}
+	if f.Log != nil {
+		// Keep the time-based name for generic logs.
+		if f.Log.Name != "Workout" && f.Log.Name != "Activity" {
+			act.Name = f.Log.Name
+		}
+		act.ExternalID = ExternalID(*f.Log)
+	}
+	return act, nil
+}
+
+// CleanSamples applies the cleaning options for activityName and reports
+// what changed.
+func (p *Pipeline) CleanSamples(samples []encoder.Sample, opts Options, activityName string) []encoder.Sample {
+	if opts.Clean == nil {
+		return samples
+	}
+	clean := opts.Clean(activityName)
+	if clean == nil {
+		return samples
+	}
+	cleaned, report := encoder.Clean(samples, *clean)
+	p.Log.Info("Cleaned heart rate", "summary", report.String())
+	return cleaned
+}
+
+// DefaultActivityName names an activity by the time of day it started.
+func DefaultActivityName(start time.Time) string {
+	hour := start.Hour()
+	switch {
+	case hour >= 4 && hour < 12:
+		return "Morning workout ☀️"
+	case hour >= 12 && hour < 17:
+		return "Afternoon workout 💪"
+	case hour >= 17 && hour < 21:
+		return "Evening workout 🌙"
+	default:
+		return "Night workout 🌚"
+	}
+}
@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit"
+)
+
+// ErrNoHeartRate is returned by Fetch when Fitbit has no heart rate for the
+// period, usually because the tracker hasn't synced yet.
+var ErrNoHeartRate = errors.New("no heart rate data for this period")
+
+// Source is where Fetch reads an activity's data: the Fitbit API, or a
+// data export that provides the same calls.
+type Source interface {
+	FetchIntradayHeartRate(date, startTime, endTime string) (*fitbit.HeartRateResponse, error)
+	GetActivityLogs(date string) (*fitbit.ActivityLogsResponse, error)
+	FetchIntradaySteps(date, startTime, endTime string) (*fitbit.IntradaySeries, error)
+	FetchIntradayDistance(date, startTime, endTime string) (*fitbit.IntradaySeries, error)
+	FetchIntradayCalories(date, startTime, endTime string) (*fitbit.IntradaySeries, error)
+	GetProfile() (*fitbit.Profile, error)
+	GetDevices() ([]fitbit.Device, error)
+}
+
+// source returns p.Source, or the Fitbit API when it is unset.
+func (p *Pipeline) source() Source {
+	if p.Source != nil {
+		return p.Source
+	}
+	return p.Fitbit
+}
+
+// Window is the period an activity covers, in local time.
+type Window struct {
+	Start    time.Time
+	Duration time.Duration
+}
+
+// WindowFor returns the period of a logged activity.
+func WindowFor(act fitbit.ActivityLog) (Window, error) {
+	start, err := StartTime(act)
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{Start: start.Local(), Duration: time.Duration(act.Duration) * time.Millisecond}, nil
+}
+
+func (w Window) End() time.Time { return w.Start.Add(w.Duration) }
+
+// Date returns the start date as YYYY-MM-DD, as the Fitbit API takes it.
+func (w Window) Date() string { return w.Start.Format("2006-01-02") }
+
+// Clock returns the start and end as HH:mm.
+func (w Window) Clock() (start, end string) {
+	return w.Start.Format("15:04"), w.End().Format("15:04")
+}
+
+// Fetched is what Fitbit knows about an activity, ready to encode.
+type Fetched struct {
+	Window    Window
+	Name      string // activity type, e.g. "Spinning"
+	HeartRate *fitbit.HeartRateResponse
+	Series    Series
+	// Log is the activity log starting in the same minute, if any.
+	Log *fitbit.ActivityLog
+	// Profile is only fetched when there is no logged calorie total.
+	Profile *fitbit.Profile
+	Device  *fitbit.Device
+}
+
+// Fetch downloads the heart rate for the window along with the activity
+// log, the minute series the activity uses, the profile and the recording
+// device, from p.Source. name is the activity type to use if no log
+// matches. Only the heart rate is required; the rest are skipped with a
+// warning if they fail.
+func (p *Pipeline) Fetch(win Window, name string) (*Fetched, error) {
+	src := p.source()
+	date := win.Date()
+	startClock, endClock := win.Clock()
+	p.Log.Info("Fetching heart rate", "date", date, "start", startClock, "end", endClock)
+
+	hrData, err := src.FetchIntradayHeartRate(date, startClock, endClock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Fitbit data: %w", err)
+	}
+	p.Log.Info("Retrieved heart rate", "samples", len(hrData.ActivitiesHeartIntraday.Dataset))
+	if len(hrData.ActivitiesHeartIntraday.Dataset) == 0 {
+		return nil, ErrNoHeartRate
+	}
+
+	f := &Fetched{Window: win, Name: name, HeartRate: hrData}
+	if f.Name == "" {
+		f.Name = "Workout"
+	}
+
+	logs, err := src.GetActivityLogs(date)
+	if err != nil {
+		p.Log.Warn("Failed to fetch activity logs", "error", err)
+	} else if f.Log = MatchLog(logs.Activities, win); f.Log != nil {
+		f.Name = f.Log.Name
+		p.Log.Info("Found matching activity log", "name", f.Log.Name, "calories", f.Log.Calories)
+	}
+
+	// Steps and distance for treadmill runs and walks
+	if encoder.UsesSteps(f.Name) {
+		if f.Series.Steps, err = src.FetchIntradaySteps(date, startClock, endClock); err != nil {
+			p.Log.Warn("Failed to fetch steps", "error", err)
+		}
+		if f.Series.Distance, err = src.FetchIntradayDistance(date, startClock, endClock); err != nil {
+			p.Log.Warn("Failed to fetch distance", "error", err)
+		}
+	}
+	if f.Series.Calories, err = src.FetchIntradayCalories(date, startClock, endClock); err != nil {
+		p.Log.Warn("Failed to fetch calories", "error", err)
+	}
+
+	// The profile is for estimating calories when no log gives the total.
+	if f.Log == nil || f.Log.Calories == 0 {
+		if f.Profile, err = src.GetProfile(); err != nil {
+			// Tokens issued before the profile scope was added will get a 403 here.
+			p.Log.Warn("Failed to fetch profile, calories will not be estimated from heart rate", "error", err)
+		}
+	}
+
+	devices, err := src.GetDevices()
+	if err != nil {
+		// Tokens issued before the settings scope was added will get a 403 here.
+		p.Log.Warn("Failed to fetch devices", "error", err)
+	} else {
+		f.Device = FindDevice(devices, f.source())
+		if SyncedBefore(f.Device, win.End()) {
+			p.Log.Warn("Device last synced before the activity ended; heart rate data may be incomplete",
+				"device", f.Device.DeviceVersion, "last_sync", f.Device.LastSyncTime)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *Fetched) source() *fitbit.ActivityLogSource {
+	if f.Log == nil {
+		return nil
+	}
+	return &f.Log.Source
+}
+
+// MatchLog returns the activity log that starts in the window's first
+// minute. The daily log endpoint gives start times as HH:mm.
+func MatchLog(logs []fitbit.ActivityLog, win Window) *fitbit.ActivityLog {
+	start := win.Start.Format("15:04")
+	for i := range logs {
+		if logs[i].StartTime == start {
+			return &logs[i]
+		}
+	}
+	return nil
+}
+
+// FetchHeartRateSpan fetches 1-second heart rate between start and end,
+// which may cross midnight. Times are in the local zone.
+func (p *Pipeline) FetchHeartRateSpan(start, end time.Time) ([]encoder.Sample, error) {
+	var samples []encoder.Sample
+	y, m, d := start.Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, time.Local); !day.After(end); day = day.AddDate(0, 0, 1) {
+		from, to := "00:00", "23:59"
+		if sameDay(day, start) {
+			from = start.Format("15:04")
+		}
+		if sameDay(day, end) {
+			// The range is whole minutes; include the minute end falls in.
+			to = end.Format("15:04")
+		}
+		date := day.Format("2006-01-02")
+		data, err := p.source().FetchIntradayHeartRate(date, from, to)
+		if err != nil {
+			return nil, err
+		}
+		daySamples, err := HeartRateSamples(date, data)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, daySamples...)
+	}
+	return samples, nil
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// FetchGPS downloads Fitbit's TCX export of a GPS activity, optionally
+// filling in heart rate from the 1-second series. Failing to add heart rate
+// is only a warning; the TCX is returned as recorded.
+func (p *Pipeline) FetchGPS(act fitbit.ActivityLog, enrichHR bool, opts Options) (destination.Activity, error) {
+	start, err := StartTime(act)
+	if err != nil {
+		return destination.Activity{}, err
+	}
+	p.Log.Info("Fetching TCX", "name", act.Name, "log_id", act.LogID)
+	data, err := p.Fitbit.FetchActivityTCX(act.LogID)
+	if err != nil {
+		return destination.Activity{}, fmt.Errorf("failed to fetch Fitbit TCX: %w", err)
+	}
+
+	if enrichHR {
+		win, _ := WindowFor(act)
+		startClock, endClock := win.Clock()
+		hrData, err := p.Fitbit.FetchIntradayHeartRate(win.Date(), startClock, endClock)
+		if err != nil {
+			p.Log.Warn("Failed to fetch heart rate, uploading TCX as-is", "error", err)
+		} else if samples, err := HeartRateSamples(win.Date(), hrData); err != nil {
+			p.Log.Warn("Failed to read heart rate, uploading TCX as-is", "error", err)
+		} else if enriched, merged, err := encoder.EnrichTCX(data, p.CleanSamples(samples, opts, act.Name)); err != nil {
+			p.Log.Warn("Failed to add heart rate to TCX, uploading as-is", "error", err)
+		} else {
+			data = enriched
+			p.Log.Info("Added heart rate to TCX", "samples", len(samples), "trackpoints", merged)
+		}
+	}
+
+	return destination.Activity{
+		Data:       data,
+		Format:     "tcx",
+		Name:       act.Name,
+		Sport:      act.Name,
+		StartTime:  start,
+		ExternalID: ExternalID(act),
+	}, nil
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fitbit-strava/config"
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit/export"
+)
+
+// writeExport writes a data export with one spinning class at start, and
+// heart rate for it unless withHR is false.
+func writeExport(t *testing.T, start time.Time, withHR bool) string {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("exercise-0.json", []map[string]any{{
+		"logId":        int64(4711),
+		"activityName": "Spinning",
+		"calories":     250,
+		"duration":     10 * 60 * 1000,
+		"startTime":    start.Format("01/02/06 15:04:05"),
+	}})
+	if withHR {
+		var points []map[string]any
+		for i := range 600 {
+			at := start.Add(time.Duration(i) * time.Second).UTC()
+			points = append(points, map[string]any{
+				"dateTime": at.Format("01/02/06 15:04:05"),
+				"value":    map[string]any{"bpm": 120 + i%20, "confidence": 2},
+			})
+		}
+		write("heart_rate-"+start.UTC().Format("2006-01-02")+".json", points)
+	}
+	return dir
+}
+
+func exportPipeline(t *testing.T, dir string) (*Pipeline, *export.Export) {
+	t.Helper()
+	exp, err := export.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { exp.Close() })
+	return &Pipeline{Config: &config.Config{}, Source: exp, Log: slog.New(slog.NewTextHandler(io.Discard, nil))}, exp
+}
+
+func TestFetchFromExport(t *testing.T) {
+	start := time.Date(2021, 3, 14, 18, 30, 0, 0, time.Local)
+	p, exp := exportPipeline(t, writeExport(t, start, true))
+	acts, err := exp.Activities()
+	if err != nil || len(acts) != 1 {
+		t.Fatalf("Activities = %v, %v", acts, err)
+	}
+	win, err := WindowFor(acts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := p.Fetch(win, acts[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Log == nil || fetched.Log.LogID != 4711 {
+		t.Fatalf("matched log %+v, want the exported activity", fetched.Log)
+	}
+	act, err := p.Encode(fetched, Options{Format: encoder.FormatTCX})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Format != "tcx" || act.Name != "Spinning" || act.ExternalID != "fitbit-4711" || !act.StartTime.Equal(start) {
+		t.Errorf("encoded %s %q %s at %v", act.Format, act.Name, act.ExternalID, act.StartTime)
+	}
+}
+
+func TestFetchFromExportWithoutHeartRate(t *testing.T) {
+	start := time.Date(2021, 3, 14, 18, 30, 0, 0, time.Local)
+	p, exp := exportPipeline(t, writeExport(t, start, false))
+	acts, _ := exp.Activities()
+	win, err := WindowFor(acts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Fetch(win, acts[0].Name); !errors.Is(err, ErrNoHeartRate) {
+		t.Errorf("Fetch = %v, want ErrNoHeartRate", err)
+	}
+}
@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+)
+
+// Hook points, where the programs configured as HOOK_SELECTED,
+// HOOK_ENCODED, HOOK_BEFORE_UPLOAD and HOOK_UPLOADED run.
+const (
+	HookSelected     = "selected"      // chosen to sync, before anything is fetched
+	HookEncoded      = "encoded"       // the file is built
+	HookBeforeUpload = "before-upload" // about to go to the destinations
+	HookUploaded     = "uploaded"      // after the uploads, with their results
+)
+
+// hookTimeout bounds a hook, so a stuck script doesn't stall a sync.
+var hookTimeout = time.Minute
+
+// ErrSkipped is returned for an activity a hook decided not to sync.
+var ErrSkipped = errors.New("skipped by hook")
+
+// HookActivity describes the activity to a hook.
+type HookActivity struct {
+	LogID       int64     `json:"fitbit_log_id,omitempty"`
+	Name        string    `json:"name"`
+	Sport       string    `json:"sport,omitempty"`
+	Description string    `json:"description,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	Duration    int       `json:"duration_seconds,omitempty"`
+	ExternalID  string    `json:"external_id,omitempty"`
+	HasGPS      bool      `json:"has_gps,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	// File is a temporary copy of the encoded file, from HookEncoded on.
+	File string `json:"file,omitempty"`
+}
+
+// HookUpload is the outcome of uploading to one destination.
+type HookUpload struct {
+	ID    string `json:"id,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// hookInput is the JSON a hook reads on stdin.
+type hookInput struct {
+	Hook     string       `json:"hook"`
+	Activity HookActivity `json:"activity"`
+	// Uploads are keyed by destination name, for HookUploaded.
+	Uploads map[string]HookUpload `json:"uploads,omitempty"`
+}
+
+// HookOutput is the JSON a hook may print on stdout. No output changes
+// nothing; fields left out keep their values. Output from HookUploaded is
+// ignored.
+type HookOutput struct {
+	Skip   bool   `json:"skip"`
+	Reason string `json:"reason"`
+
+	Name        *string `json:"name"`
+	Sport       *string `json:"sport"`
+	Description *string `json:"description"`
+}
+
+// Apply makes the hook's changes to act. A nil HookOutput changes nothing.
+func (o *HookOutput) Apply(act *destination.Activity) {
+	if o == nil {
+		return
+	}
+	if o.Name != nil {
+		act.Name = *o.Name
+	}
+	if o.Sport != nil {
+		act.Sport = *o.Sport
+	}
+	if o.Description != nil {
+		act.Description = *o.Description
+	}
+}
+
+// Selected runs the selected hook for the logged activity act, or the
+// window when act is nil. Its changes are returned to Apply once the
+// activity is encoded.
+func (p *Pipeline) Selected(act *fitbit.ActivityLog, win Window) (*HookOutput, error) {
+	meta := HookActivity{
+		Name:      DefaultActivityName(win.Start),
+		StartTime: win.Start,
+		Duration:  int(win.Duration.Seconds()),
+	}
+	if act != nil {
+		meta.LogID = act.LogID
+		meta.Name = act.Name
+		meta.Sport = act.Name
+		meta.ExternalID = ExternalID(*act)
+		meta.HasGPS = act.HasGPS
+	}
+	return p.hook(HookSelected, hookInput{Activity: meta})
+}
+
+// Encoded runs the encoded hook on a freshly encoded activity and returns
+// the activity with its changes.
+func (p *Pipeline) Encoded(act destination.Activity) (destination.Activity, error) {
+	out, err := p.hookWithFile(HookEncoded, act, nil)
+	if err != nil {
+		return act, err
+	}
+	out.Apply(&act)
+	return act, nil
+}
+
+// hookWithFile runs the hook at point with act, written to a temporary
+// file for the hook to read.
+func (p *Pipeline) hookWithFile(point string, act destination.Activity, uploads map[string]HookUpload) (*HookOutput, error) {
+	if p.hookPath(point) == "" {
+		return nil, nil
+	}
+	meta := HookActivity{
+		Name:        act.Name,
+		Sport:       act.Sport,
+		Description: act.Description,
+		StartTime:   act.StartTime,
+		ExternalID:  act.ExternalID,
+		Format:      act.Format,
+	}
+	file, err := os.CreateTemp("", "fitbit-strava-*."+act.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file for %s hook: %v", point, err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(act.Data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write file for %s hook: %v", point, err)
+	}
+	meta.File = file.Name()
+	return p.hook(point, hookInput{Activity: meta, Uploads: uploads})
+}
+
+func (p *Pipeline) hookPath(point string) string {
+	if p.Config == nil {
+		return ""
+	}
+	switch point {
+	case HookSelected:
+		return p.Config.HookSelected
+	case HookEncoded:
+		return p.Config.HookEncoded
+	case HookBeforeUpload:
+		return p.Config.HookBeforeUpload
+	case HookUploaded:
+		return p.Config.HookUploaded
+	}
+	return ""
+}
+
+// hook runs the program configured for point, if any, with in as JSON on
+// stdin and FITBIT_STRAVA_HOOK set to point. Its stderr goes to ours. A
+// skip comes back as an error wrapping ErrSkipped.
+func (p *Pipeline) hook(point string, in hookInput) (*HookOutput, error) {
+	path := p.hookPath(point)
+	if path == "" {
+		return nil, nil
+	}
+	in.Hook = point
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s hook input: %v", point, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "FITBIT_STRAVA_HOOK="+point)
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s hook %s failed: %v", point, path, err)
+	}
+
+	stdout = bytes.TrimSpace(stdout)
+	p.Log.Debug("Ran hook", "hook", point, "path", path, "output", string(stdout))
+	if point == HookUploaded {
+		return nil, nil
+	}
+	var out HookOutput
+	if len(stdout) > 0 {
+		if err := json.Unmarshal(stdout, &out); err != nil {
+			return nil, fmt.Errorf("invalid output from %s hook %s: %v", point, path, err)
+		}
+	}
+	if out.Skip {
+		reason := out.Reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return nil, fmt.Errorf("%w at %s: %s", ErrSkipped, point, reason)
+	}
+	return &out, nil
+}
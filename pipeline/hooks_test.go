@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"fitbit-strava/config"
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/ledger"
+)
+
+// writeHook writes a shell script hook that saves its input next to it, in
+// input.json, and then runs body.
+func writeHook(t *testing.T, body string) (path, input string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	dir := t.TempDir()
+	path, input = filepath.Join(dir, "hook"), filepath.Join(dir, "input.json")
+	script := "#!/bin/sh\ncat > " + input + "\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, input
+}
+
+func hookPipeline(cfg *config.Config) *Pipeline {
+	return &Pipeline{Config: cfg, Log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+func encodedActivity() destination.Activity {
+	return destination.Activity{
+		Data:       []byte("fit data"),
+		Format:     "fit",
+		Name:       "Evening workout",
+		Sport:      "Spinning",
+		StartTime:  time.Date(2026, 10, 16, 18, 30, 0, 0, time.UTC),
+		ExternalID: "fitbit-4711",
+	}
+}
+
+func TestEncodedHookOverrides(t *testing.T) {
+	hook, input := writeHook(t, `echo '{"name": "Zwift ride", "description": "Watopia"}'`)
+	p := hookPipeline(&config.Config{HookEncoded: hook})
+
+	act, err := p.Encoded(encodedActivity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields left out keep their values.
+	if act.Name != "Zwift ride" || act.Description != "Watopia" || act.Sport != "Spinning" {
+		t.Errorf("activity after hook: name %q, sport %q, description %q", act.Name, act.Sport, act.Description)
+	}
+
+	var in hookInput
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Hook != HookEncoded || in.Activity.ExternalID != "fitbit-4711" || in.Activity.Format != "fit" || in.Activity.File == "" {
+		t.Errorf("hook input = %+v", in)
+	}
+	if _, err := os.Stat(in.Activity.File); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s left behind", in.Activity.File)
+	}
+}
+
+func TestSelectedHookSkips(t *testing.T) {
+	hook, _ := writeHook(t, `[ "$FITBIT_STRAVA_HOOK" = selected ] && echo '{"skip": true, "reason": "commute"}'`)
+	p := hookPipeline(&config.Config{HookSelected: hook})
+
+	act := &fitbit.ActivityLog{LogID: 4711, Name: "Walk"}
+	_, err := p.Selected(act, Window{Start: time.Now(), Duration: time.Hour})
+	if !errors.Is(err, ErrSkipped) || !strings.Contains(err.Error(), "commute") {
+		t.Errorf("Selected = %v, want ErrSkipped with the reason", err)
+	}
+}
+
+func TestHookFailures(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"exit status", "echo 'no token' >&2; exit 3", "exit status 3"},
+		{"invalid output", "echo 'done!'", "invalid output"},
+	}
+	for _, tt := range tests {
+		hook, _ := writeHook(t, tt.body)
+		p := hookPipeline(&config.Config{HookEncoded: hook})
+		_, err := p.Encoded(encodedActivity())
+		if err == nil || errors.Is(err, ErrSkipped) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Encoded = %v, want an error with %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	defer func(d time.Duration) { hookTimeout = d }(hookTimeout)
+	hookTimeout = 100 * time.Millisecond
+	hook, _ := writeHook(t, "exec sleep 10")
+	p := hookPipeline(&config.Config{HookEncoded: hook})
+
+	start := time.Now()
+	if _, err := p.Encoded(encodedActivity()); err == nil {
+		t.Error("Encoded succeeded with a stuck hook")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stuck hook ran for %s", elapsed)
+	}
+}
+
+func TestUploadedHookOutputIgnored(t *testing.T) {
+	t.Chdir(t.TempDir())
+	book, err := ledger.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Neither a skip nor garbage changes the outcome of the uploads.
+	for i, body := range []string{`echo '{"skip": true, "name": "other"}'`, "echo 'not json'"} {
+		hook, input := writeHook(t, body)
+		p := hookPipeline(&config.Config{HookUploaded: hook})
+		p.Ledger = book
+		p.Destinations = []destination.Destination{&fakeDestination{name: "archive"}}
+
+		act := encodedActivity()
+		act.ExternalID = fmt.Sprintf("fitbit-%d", i)
+		outcomes, err := p.Upload(act)
+		if err != nil || len(outcomes) != 1 {
+			t.Fatalf("%s: Upload = %v, %v", body, outcomes, err)
+		}
+		if _, ok := book.Uploaded(act.ExternalID, "archive"); !ok {
+			t.Errorf("%s: upload not recorded", body)
+		}
+
+		var in hookInput
+		data, _ := os.ReadFile(input)
+		if err := json.Unmarshal(data, &in); err != nil || in.Uploads["archive"].ID != "archive-1" {
+			t.Errorf("%s: hook input %s, %v", body, data, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package pipeline holds the steps every command shares to turn a Fitbit
+// activity into an uploaded file:
+//
+//	select   Recent, Synced             which activities to sync
+//	fetch    Fetch, FetchGPS            heart rate and supporting series
+//	match    MatchLog, FindDevice       the activity log and recording device
+//	encode   Encode                     the FIT, TCX or GPX file
+//	upload   Upload                     every destination, noted in the ledger
+//	hooks    Selected, Encoded          user programs that may change or skip
+//
+// Commands decide how activities are chosen and confirmed; the pipeline does
+// the rest.
+package pipeline
+
+import (
+	"log/slog"
+
+	"fitbit-strava/config"
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/ledger"
+	"fitbit-strava/notify"
+)
+
+type Pipeline struct {
+	Config *config.Config
+	Fitbit *fitbit.Client
+	// Source is where Fetch reads activity data; nil reads the Fitbit API.
+	Source       Source
+	Destinations []destination.Destination
+	Ledger       *ledger.Ledger
+	// Log receives progress and warnings.
+	Log *slog.Logger
+	// Notify is told how activities and runs went; nil tells no one.
+	Notify *notify.Dispatcher
+}
+
+func New(cfg *config.Config, fitbitClient *fitbit.Client, dests []destination.Destination, book *ledger.Ledger) *Pipeline {
+	return &Pipeline{
+		Config:       cfg,
+		Fitbit:       fitbitClient,
+		Destinations: dests,
+		Ledger:       book,
+		Log:          slog.Default(),
+	}
+}
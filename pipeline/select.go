@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fitbit-strava/fitbit"
+	"fitbit-strava/ledger"
+	"fitbit-strava/strava"
+)
+
+// logTimeLayout is the layout of ActivityLog.StartTime in the activity list.
+const logTimeLayout = "2006-01-02T15:04:05.000-07:00"
+
+// StartTime parses an activity's start time.
+func StartTime(act fitbit.ActivityLog) (time.Time, error) {
+	t, err := time.Parse(logTimeLayout, act.StartTime)
+	if err != nil {
+		return t, fmt.Errorf("invalid start time %q: %v", act.StartTime, err)
+	}
+	return t, nil
+}
+
+// ExternalID identifies a Fitbit activity to destinations and in the ledger.
+func ExternalID(act fitbit.ActivityLog) string {
+	return fmt.Sprintf("fitbit-%d", act.LogID)
+}
+
+// Recent returns up to limit of the most recent activities, newest first.
+// GPS activities usually reach Strava on their own, so they are left out
+// unless includeGPS is set.
+func (p *Pipeline) Recent(limit int, includeGPS bool) ([]fitbit.ActivityLog, error) {
+	recent, err := p.Fitbit.GetRecentActivities(limit)
+	if err != nil {
+		return nil, err
+	}
+	activities := make([]fitbit.ActivityLog, 0, len(recent.Activities))
+	for _, act := range recent.Activities {
+		if act.HasGPS && !includeGPS {
+			continue
+		}
+		activities = append(activities, act)
+	}
+	return activities, nil
+}
+
+// maxPage is the most activities Fitbit returns per list request.
+const maxPage = 100
+
+// Since returns the activities that started after since, newest first,
+// paging back through the activity list as far as it takes. GPS activities
+// are left out unless includeGPS is set, as in Recent.
+func (p *Pipeline) Since(since time.Time, includeGPS bool) ([]fitbit.ActivityLog, error) {
+	var activities []fitbit.ActivityLog
+	seen := make(map[int64]bool)
+	before := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	for {
+		page, err := p.Fitbit.GetActivitiesBefore(before, maxPage)
+		if err != nil {
+			return nil, err
+		}
+		var oldest time.Time
+		for _, act := range page.Activities {
+			start, err := StartTime(act)
+			if err != nil || seen[act.LogID] {
+				continue
+			}
+			seen[act.LogID] = true
+			oldest = start
+			if start.Before(since) {
+				return activities, nil
+			}
+			if act.HasGPS && !includeGPS {
+				continue
+			}
+			activities = append(activities, act)
+		}
+		if len(page.Activities) < maxPage || oldest.IsZero() {
+			return activities, nil
+		}
+		// The oldest start, in its own local time, is the next page's cursor.
+		before = oldest.Format("2006-01-02T15:04:05")
+	}
+}
+
+// Pending returns the activities among the limit most recent that started
+// in the last days days and aren't synced to every destination yet or
+// skipped, newest first.
+func (p *Pipeline) Pending(limit, days int, includeGPS bool) ([]fitbit.ActivityLog, error) {
+	recent, err := p.Recent(limit, includeGPS)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	var pending []fitbit.ActivityLog
+	for _, act := range recent {
+		start, err := StartTime(act)
+		if err != nil || start.Before(since) || p.Synced(act) || p.Skipped(act) != "" {
+			continue
+		}
+		pending = append(pending, act)
+	}
+	return pending, nil
+}
+
+// WaitingForDevice reports whether the device that recorded act hasn't
+// synced since the activity ended, so the end of its heart rate may not
+// have reached Fitbit yet.
+func WaitingForDevice(act fitbit.ActivityLog, devices []fitbit.Device) bool {
+	win, err := WindowFor(act)
+	if err != nil {
+		return false
+	}
+	return SyncedBefore(FindDevice(devices, &act.Source), win.End())
+}
+
+// Synced reports whether the ledger has the activity uploaded to every
+// configured destination.
+func (p *Pipeline) Synced(act fitbit.ActivityLog) bool {
+	entry := p.Ledger.Get(ExternalID(act))
+	if entry == nil {
+		return false
+	}
+	for _, name := range p.Config.Destinations {
+		if _, ok := entry.Uploads[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Skipped returns why the ledger has the activity down as skipped, or ""
+// if it isn't.
+func (p *Pipeline) Skipped(act fitbit.ActivityLog) string {
+	entry := p.Ledger.Get(ExternalID(act))
+	if entry == nil {
+		return ""
+	}
+	return entry.Skipped
+}
+
+// Skip records in the ledger that the activity was skipped for reason, so
+// Pending leaves it out from then on.
+func (p *Pipeline) Skip(act fitbit.ActivityLog, reason error) error {
+	start, _ := StartTime(act)
+	entry := ledger.Entry{Name: act.Name, Sport: act.Name, StartTime: start}
+	if err := p.Ledger.Skip(ExternalID(act), entry, reason.Error()); err != nil {
+		return fmt.Errorf("failed to update sync ledger: %v", err)
+	}
+	return nil
+}
+
+// maxStartOffset is how far apart a Fitbit activity and a Strava activity
+// may start and still be taken for the same workout.
+const maxStartOffset = 2 * time.Minute
+
+// MatchStrava returns the Strava activity for a Fitbit activity: the one
+// uploaded with its external id, or else one starting at the same time,
+// such as a watch recording of the same workout.
+func MatchStrava(act fitbit.ActivityLog, activities []strava.SummaryActivity) *strava.SummaryActivity {
+	id := ExternalID(act)
+	for i := range activities {
+		// Strava may keep the upload's file extension on the id.
+		if e := activities[i].ExternalID; e == id || strings.HasPrefix(e, id+".") {
+			return &activities[i]
+		}
+	}
+	start, err := StartTime(act)
+	if err != nil {
+		return nil
+	}
+	for i := range activities {
+		if d := activities[i].StartDate.Sub(start); d < maxStartOffset && d > -maxStartOffset {
+			return &activities[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"fitbit-strava/fitbit"
+)
+
+// redirect sends every request to the test server instead of Fitbit.
+type redirect struct{ target *url.URL }
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// activityList serves the activity list endpoint from activities, which
+// are newest first, and counts the requests.
+func activityList(t *testing.T, activities []fitbit.ActivityLog) (*fitbit.Client, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		before, err := time.ParseInLocation("2006-01-02T15:04:05", q.Get("beforeDate"), time.Local)
+		if err != nil {
+			before, err = time.ParseInLocation("2006-01-02", q.Get("beforeDate"), time.Local)
+		}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if err != nil || q.Get("sort") != "desc" || limit > 100 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		page := []fitbit.ActivityLog{}
+		for _, act := range activities {
+			if start, _ := StartTime(act); start.Before(before) && len(page) < limit {
+				page = append(page, act)
+			}
+		}
+		json.NewEncoder(w).Encode(fitbit.ActivityLogsResponse{Activities: page})
+	}))
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	return fitbit.NewClient(&http.Client{Transport: redirect{target}}), &requests
+}
+
+func TestSincePagesBack(t *testing.T) {
+	// An activity every two hours for 30 days, every tenth with GPS.
+	now := time.Now().Truncate(time.Second)
+	var activities []fitbit.ActivityLog
+	for i := range 360 {
+		activities = append(activities, fitbit.ActivityLog{
+			LogID:     int64(1000 - i),
+			StartTime: now.Add(-time.Duration(2*i+1) * time.Hour).Format(logTimeLayout),
+			HasGPS:    i%10 == 0,
+		})
+	}
+	client, requests := activityList(t, activities)
+	p := &Pipeline{Fitbit: client}
+
+	since := now.AddDate(0, 0, -20)
+	got, err := p.Since(since, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 240 || *requests != 3 {
+		t.Fatalf("got %d activities in %d requests, want 240 in 3", len(got), *requests)
+	}
+	for i, act := range got {
+		if act.LogID != int64(1000-i) {
+			t.Fatalf("activity %d is %d, want %d: newest first, no gaps or repeats", i, act.LogID, 1000-i)
+		}
+	}
+
+	withoutGPS, err := p.Since(since, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withoutGPS) != 216 {
+		t.Errorf("got %d activities without GPS, want 216", len(withoutGPS))
+	}
+}
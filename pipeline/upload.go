@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/ledger"
+)
+
+// Upload sends the activity to every destination the ledger has no upload
+// of it for, prints the outcome of each and records the successful ones in
+// the ledger. Destinations it was already uploaded to are returned with
+// their recorded result, so retrying a partial sync doesn't upload it
+// twice. The before-upload hook may change or skip it first, and the
+// uploaded hook is told how it went. It returns the outcomes, and an error
+// if any destination failed.
+func (p *Pipeline) Upload(act destination.Activity) ([]destination.Outcome, error) {
+	key := LedgerKey(act)
+	var dests []destination.Destination
+	var done []destination.Outcome
+	for _, d := range p.Destinations {
+		u, ok := p.Ledger.Uploaded(key, d.Name())
+		if !ok {
+			dests = append(dests, d)
+			continue
+		}
+		p.Log.Info("Already uploaded", "destination", d.Name(), "id", u.ID)
+		res := destination.Result{ID: u.ID, UploadID: u.UploadID, URL: u.URL, Detail: "already uploaded"}
+		done = append(done, destination.Outcome{Destination: d.Name(), Result: res})
+	}
+	if len(dests) == 0 {
+		return done, nil
+	}
+
+	out, err := p.hookWithFile(HookBeforeUpload, act, nil)
+	if err != nil {
+		return nil, err
+	}
+	out.Apply(&act)
+
+	p.Log.Info("Uploading", "destinations", destination.Names(dests))
+	outcomes := destination.UploadAll(dests, act)
+	entry := ledger.Entry{Name: act.Name, Sport: act.Sport, StartTime: act.StartTime}
+	uploads := make(map[string]HookUpload, len(outcomes))
+	for _, o := range outcomes {
+		if o.Err != nil {
+			p.Log.Warn("Upload failed", "destination", o.Destination, "error", o.Err)
+			uploads[o.Destination] = HookUpload{Error: o.Err.Error()}
+			continue
+		}
+		p.Log.Info("Upload successful", "destination", o.Destination, "detail", o.Result.Detail)
+		uploads[o.Destination] = HookUpload{ID: o.Result.ID, URL: o.Result.URL}
+		upload := ledger.Upload{ID: o.Result.ID, UploadID: o.Result.UploadID, URL: o.Result.URL}
+		if err := p.Ledger.Record(key, entry, o.Destination, upload); err != nil {
+			p.Log.Warn("Failed to update sync ledger", "error", err)
+		}
+	}
+	// The uploads happened either way, so a failing hook is only a warning.
+	if _, err := p.hookWithFile(HookUploaded, act, uploads); err != nil {
+		p.Log.Warn("Uploaded hook failed", "error", err)
+	}
+	return append(done, outcomes...), destination.Failed(outcomes)
+}
+
+// LedgerKey identifies an activity in the ledger: its source id, or its
+// start time when it has none.
+func LedgerKey(act destination.Activity) string {
+	if act.ExternalID != "" {
+		return act.ExternalID
+	}
+	return "start-" + act.StartTime.UTC().Format(time.RFC3339)
+}
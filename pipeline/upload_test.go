@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/ledger"
+)
+
+// fakeDestination counts uploads and fails while err is set.
+type fakeDestination struct {
+	name    string
+	err     error
+	uploads int
+}
+
+func (d *fakeDestination) Name() string { return d.name }
+
+func (d *fakeDestination) Upload(a destination.Activity) (destination.Result, error) {
+	d.uploads++
+	if d.err != nil {
+		return destination.Result{}, d.err
+	}
+	return destination.Result{ID: d.name + "-1"}, nil
+}
+
+func TestUploadRetriesOnlyFailedDestinations(t *testing.T) {
+	t.Chdir(t.TempDir())
+	book, err := ledger.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strava := &fakeDestination{name: "strava", err: errors.New("rate limited")}
+	archive := &fakeDestination{name: "archive"}
+	p := &Pipeline{
+		Destinations: []destination.Destination{strava, archive},
+		Ledger:       book,
+		Log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	act := destination.Activity{Format: "fit", Name: "Spinning", StartTime: time.Now(), ExternalID: "fitbit-1"}
+
+	if _, err := p.Upload(act); err == nil {
+		t.Fatal("first upload: want an error for the failed destination")
+	}
+	if _, ok := book.Uploaded("fitbit-1", "strava"); ok {
+		t.Fatal("failed strava upload was recorded")
+	}
+
+	strava.err = nil
+	outcomes, err := p.Upload(act)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if strava.uploads != 2 || archive.uploads != 1 {
+		t.Errorf("uploads: strava %d, archive %d; want 2 and 1", strava.uploads, archive.uploads)
+	}
+	if len(outcomes) != 2 {
+		t.Fatalf("retry returned %d outcomes, want 2", len(outcomes))
+	}
+	for _, o := range outcomes {
+		if o.Err != nil || o.Result.ID != o.Destination+"-1" {
+			t.Errorf("outcome for %s = %+v", o.Destination, o)
+		}
+	}
+
+	// Synced everywhere: nothing is uploaded again.
+	if _, err := p.Upload(act); err != nil {
+		t.Fatalf("third upload: %v", err)
+	}
+	if strava.uploads != 2 || archive.uploads != 1 {
+		t.Errorf("uploads after sync: strava %d, archive %d; want 2 and 1", strava.uploads, archive.uploads)
+	}
+
+	reloaded, err := ledger.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"strava", "archive"} {
+		if _, ok := reloaded.Uploaded("fitbit-1", name); !ok {
+			t.Errorf("ledger file has no %s upload", name)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package pipeline
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fitbit-strava/config"
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit"
+
+	"github.com/tormoder/fit"
+)
+
+// Series holds the optional minute-level Fitbit series that are merged
+// into the 1-second heart rate samples.
+type Series struct {
+	Steps    *fitbit.IntradaySeries
+	Distance *fitbit.IntradaySeries // kilometres
+	Calories *fitbit.IntradaySeries // kcal per minute
+}
+
+// HeartRateSamples converts Fitbit's intraday HR for date into samples with
+// absolute timestamps. Fitbit reports times in the user's local time.
+func HeartRateSamples(date string, data *fitbit.HeartRateResponse) ([]encoder.Sample, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse date: %v", err)
+	}
+
+	samples := make([]encoder.Sample, 0, len(data.ActivitiesHeartIntraday.Dataset))
+	for _, s := range data.ActivitiesHeartIntraday.Dataset {
+		t, err := time.Parse("15:04:05", s.Time)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, encoder.Sample{
+			Time:      time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local),
+			HeartRate: clampHR(s.Value),
+		})
+	}
+	return samples, nil
+}
+
+// clampHR converts a Fitbit reading to a sample value without wrapping;
+// out-of-range readings are left for the cleaning bounds to reject.
+func clampHR(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 255)))
+}
+
+// BuildWorkout converts the Fitbit heart rate and series into a workout.
+// Steps and distance are only merged for step-based sports.
+func BuildWorkout(date string, data *fitbit.HeartRateResponse, series Series, totalCalories int, device encoder.Device, activityName string) (encoder.Workout, error) {
+	samples, err := HeartRateSamples(date, data)
+	if err != nil {
+		return encoder.Workout{}, err
+	}
+
+	w := encoder.Workout{
+		Name:     activityName,
+		Device:   device,
+		Samples:  samples,
+		Calories: totalCalories,
+	}
+	if len(samples) == 0 {
+		return w, nil
+	}
+
+	day := samples[0].Time
+	if encoder.UsesSteps(activityName) {
+		w.Steps = applyMotion(samples, series, day)
+	}
+	applySeriesCalories(samples, toBuckets(series.Calories, day))
+
+	return w, nil
+}
+
+// FindDevice returns the device that recorded the activity: the one matching
+// the activity log's source, or the only tracker when there is no source.
+func FindDevice(devices []fitbit.Device, source *fitbit.ActivityLogSource) *fitbit.Device {
+	var trackers []*fitbit.Device
+	for i := range devices {
+		d := &devices[i]
+		if source != nil && source.ID != "" && d.ID == source.ID {
+			return d
+		}
+		if d.Type == "TRACKER" {
+			trackers = append(trackers, d)
+		}
+	}
+	if source == nil && len(trackers) == 1 {
+		return trackers[0]
+	}
+	return nil
+}
+
+// WorkoutDevice describes the recording device for the activity file.
+// Fitbit has no FIT manufacturer id, so the manufacturer and product stay
+// generic unless overridden in the config. Fitbit doesn't report firmware
+// versions either, so the software version is only set by the config.
+func WorkoutDevice(source *fitbit.ActivityLogSource, device *fitbit.Device, cfg *config.Config) (encoder.Device, error) {
+	var d encoder.Device
+	if source != nil {
+		d.Name = source.Name
+		d.SerialNumber = deviceSerial(source.ID)
+	}
+	if device != nil {
+		if d.Name == "" {
+			d.Name = "Fitbit " + device.DeviceVersion
+		}
+		d.SerialNumber = deviceSerial(device.ID)
+		d.Battery = batteryStatus(device.Battery)
+	}
+
+	if cfg.DeviceManufacturer != "" {
+		m, err := encoder.ParseManufacturer(cfg.DeviceManufacturer)
+		if err != nil {
+			return d, err
+		}
+		d.Manufacturer = m
+	}
+	if cfg.DeviceProduct != "" {
+		p, err := strconv.ParseUint(cfg.DeviceProduct, 10, 16)
+		if err != nil {
+			return d, fmt.Errorf("invalid FIT_PRODUCT %q: %v", cfg.DeviceProduct, err)
+		}
+		d.Product = uint16(p)
+	}
+	if cfg.DeviceSerial != "" {
+		sn, err := strconv.ParseUint(cfg.DeviceSerial, 10, 32)
+		if err != nil {
+			return d, fmt.Errorf("invalid FIT_SERIAL_NUMBER %q: %v", cfg.DeviceSerial, err)
+		}
+		d.SerialNumber = uint32(sn)
+	}
+	if cfg.DeviceSoftware != "" {
+		v, err := strconv.ParseFloat(cfg.DeviceSoftware, 64)
+		if err != nil || v <= 0 || v*100 >= math.MaxUint16 {
+			return d, fmt.Errorf("invalid FIT_SOFTWARE_VERSION %q: want a version like 1.23", cfg.DeviceSoftware)
+		}
+		d.SoftwareVersion = v
+	}
+	return d, nil
+}
+
+// deviceSerial maps a Fitbit device id to a FIT serial number. Numeric ids
+// are used as is; others are hashed so the serial is stable per device.
+func deviceSerial(id string) uint32 {
+	if id == "" {
+		return 0
+	}
+	if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+		return uint32(n)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32()
+}
+
+func batteryStatus(level string) fit.BatteryStatus {
+	switch strings.ToLower(level) {
+	case "high":
+		return fit.BatteryStatusGood
+	case "medium":
+		return fit.BatteryStatusOk
+	case "low":
+		return fit.BatteryStatusLow
+	case "empty":
+		return fit.BatteryStatusCritical
+	}
+	return 0
+}
+
+// SyncedBefore reports whether the device last synced before t, meaning the
+// tail of the activity may not have reached Fitbit yet.
+func SyncedBefore(device *fitbit.Device, t time.Time) bool {
+	if device == nil || device.LastSyncTime == "" {
+		return false
+	}
+	synced, err := time.ParseInLocation("2006-01-02T15:04:05.000", device.LastSyncTime, time.Local)
+	if err != nil {
+		return false
+	}
+	return synced.Before(t)
+}
+
+// minuteBucket is one minute of a Fitbit intraday series.
+type minuteBucket struct {
+	start time.Time
+	value float64
+}
+
+func toBuckets(series *fitbit.IntradaySeries, day time.Time) []minuteBucket {
+	if series == nil {
+		return nil
+	}
+	buckets := make([]minuteBucket, 0, len(series.Dataset))
+	for _, p := range series.Dataset {
+		t, err := time.Parse("15:04:05", p.Time)
+		if err != nil {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		buckets = append(buckets, minuteBucket{start: start, value: p.Value})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].start.Before(buckets[j].start) })
+	return buckets
+}
+
+// bucketAt returns the index of the bucket containing t, or -1 if t is before
+// the first bucket.
+func bucketAt(buckets []minuteBucket, t time.Time) int {
+	return sort.Search(len(buckets), func(i int) bool { return buckets[i].start.After(t) }) - 1
+}
+
+// applyMotion fills distance, speed and cadence on the samples from the
+// minute buckets and returns the total steps.
+//
+// Distance and steps accumulate linearly within each minute, so distance
+// increases smoothly between buckets and a minute the activity only partly
+// covers counts only that part of its steps. Cadence is interpolated between
+// minute midpoints.
+func applyMotion(samples []encoder.Sample, series Series, day time.Time) int {
+	first, last := samples[0].Time, samples[len(samples)-1].Time
+
+	distance := toBuckets(series.Distance, day)
+	if len(distance) > 0 {
+		cumulative := accumulate(distance)
+		// Start the activity at zero even if it began mid-minute.
+		offset := accumulatedAt(distance, cumulative, first)
+		for i := range samples {
+			s := &samples[i]
+			s.Distance = (accumulatedAt(distance, cumulative, s.Time) - offset) * 1000
+			if b := bucketAt(distance, s.Time); b >= 0 {
+				s.Speed = distance[b].value * 1000 / 60
+			}
+		}
+	}
+
+	var totalSteps float64
+	steps := toBuckets(series.Steps, day)
+	if len(steps) > 0 {
+		for i := range samples {
+			samples[i].Cadence = cadenceAt(steps, samples[i].Time)
+		}
+		cumulative := accumulate(steps)
+		totalSteps = accumulatedAt(steps, cumulative, last) - accumulatedAt(steps, cumulative, first)
+	}
+
+	return int(math.Round(totalSteps))
+}
+
+// accumulate returns the running totals of buckets: element i is the sum
+// of the buckets before bucket i.
+func accumulate(buckets []minuteBucket) []float64 {
+	cumulative := make([]float64, len(buckets)+1)
+	for i, b := range buckets {
+		cumulative[i+1] = cumulative[i] + b.value
+	}
+	return cumulative
+}
+
+// accumulatedAt returns the total of the buckets up to t, counting the
+// minute t falls in pro rata. cumulative is accumulate(buckets).
+func accumulatedAt(buckets []minuteBucket, cumulative []float64, t time.Time) float64 {
+	i := bucketAt(buckets, t)
+	if i < 0 {
+		return 0
+	}
+	frac := float64(t.Sub(buckets[i].start)) / float64(time.Minute)
+	if frac > 1 {
+		// Past the end of the series, or in a gap: hold the total.
+		frac = 1
+	}
+	return cumulative[i] + buckets[i].value*frac
+}
+
+// cadenceAt returns steps per minute at t, interpolated between the
+// midpoints of the surrounding minute buckets.
+func cadenceAt(buckets []minuteBucket, t time.Time) float64 {
+	mid := func(i int) time.Time { return buckets[i].start.Add(30 * time.Second) }
+
+	i := sort.Search(len(buckets), func(i int) bool { return mid(i).After(t) })
+	switch {
+	case i == 0:
+		return buckets[0].value
+	case i == len(buckets):
+		return buckets[len(buckets)-1].value
+	}
+	a, b := buckets[i-1], buckets[i]
+	span := mid(i).Sub(mid(i - 1))
+	if span > time.Minute {
+		// Don't interpolate across missing minutes.
+		return a.value
+	}
+	frac := float64(t.Sub(mid(i-1))) / float64(span)
+	return a.value + (b.value-a.value)*frac
+}
+
+// applySeriesCalories accumulates Fitbit's per-minute calories into the
+// samples. The encoder scales the curve to the logged total.
+func applySeriesCalories(samples []encoder.Sample, calories []minuteBucket) {
+	if len(calories) == 0 {
+		return
+	}
+	const maxGap = 10 * time.Second
+	var cumulative float64
+	for i := range samples {
+		dt := time.Second
+		if i+1 < len(samples) {
+			dt = min(samples[i+1].Time.Sub(samples[i].Time), maxGap)
+		}
+		if b := bucketAt(calories, samples[i].Time); b >= 0 {
+			cumulative += calories[b].value * dt.Minutes()
+		}
+		samples[i].Calories = cumulative
+	}
+}
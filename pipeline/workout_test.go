@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"fitbit-strava/config"
+	"fitbit-strava/encoder"
+	"fitbit-strava/fitbit"
+)
+
+func TestWorkoutDeviceSoftwareVersion(t *testing.T) {
+	d, err := WorkoutDevice(nil, nil, &config.Config{DeviceSoftware: "26.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SoftwareVersion != 26.10 {
+		t.Errorf("SoftwareVersion = %v, want 26.10", d.SoftwareVersion)
+	}
+
+	for _, v := range []string{"v1", "-1", "700"} {
+		if _, err := WorkoutDevice(nil, nil, &config.Config{DeviceSoftware: v}); err == nil {
+			t.Errorf("FIT_SOFTWARE_VERSION=%s accepted", v)
+		}
+	}
+}
+
+func TestApplyMotionCountsEdgeMinutesProRata(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	series := Series{
+		Steps: &fitbit.IntradaySeries{Dataset: []fitbit.IntradayPoint{
+			{Time: "12:00:00", Value: 100},
+			{Time: "12:01:00", Value: 120},
+			{Time: "12:02:00", Value: 90},
+			{Time: "12:03:00", Value: 150},
+		}},
+		Distance: &fitbit.IntradaySeries{Dataset: []fitbit.IntradayPoint{
+			{Time: "12:00:00", Value: 0.12},
+			{Time: "12:01:00", Value: 0.15},
+			{Time: "12:02:00", Value: 0.12},
+		}},
+	}
+	// From 12:00:30 to 12:02:20: half of the first minute, all of the
+	// second and a third of the third.
+	start := day.Add(12*time.Hour + 30*time.Second)
+	var samples []encoder.Sample
+	for i := range 111 {
+		samples = append(samples, encoder.Sample{Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	if steps := applyMotion(samples, series, day); steps != 50+120+30 {
+		t.Errorf("steps = %d, want %d", steps, 50+120+30)
+	}
+	if got, want := samples[len(samples)-1].Distance, 60.0+150+40; got < want-1e-6 || got > want+1e-6 {
+		t.Errorf("distance = %v m, want %v", got, want)
+	}
+	if samples[0].Distance != 0 {
+		t.Errorf("distance starts at %v m, want 0", samples[0].Distance)
+	}
+}
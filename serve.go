@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/metrics"
+	"fitbit-strava/pipeline"
+	"fitbit-strava/webhook"
+)
+
+// runServe implements `fitbit-strava serve`: an HTTP server receiving
+// Fitbit's subscription notifications, which syncs the activities of each
+// day Fitbit reports a change for, and Strava's events, which keep the
+// ledger up to date with changes made on Strava.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8081", "Address to listen on")
+	limit := fs.Int("limit", 20, "Look for the notified day's activities among this many of the most recent")
+	encode := newEncodeFlags(fs)
+	gps := newGPSFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava serve [flags]")
+		fmt.Fprintln(os.Stderr, "Fitbit notifications are received at /fitbit/webhook, Strava events at /strava/webhook.")
+		fmt.Fprintln(os.Stderr, "/metrics and /healthz report on the server.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts, err := encode.options()
+	if err != nil {
+		return reportError(err)
+	}
+
+	cfg, authenticator := loadAuth()
+	if cfg.FitbitVerificationCode == "" && cfg.StravaVerifyToken == "" {
+		return reportError(fmt.Errorf("missing FITBIT_SUBSCRIBER_VERIFICATION_CODE or STRAVA_WEBHOOK_VERIFY_TOKEN in .env"))
+	}
+	p := newPipeline(cfg, authenticator)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queue := newDateQueue()
+	mux := http.NewServeMux()
+	if cfg.FitbitVerificationCode != "" {
+		mux.Handle("/fitbit/webhook", &webhook.Fitbit{
+			VerificationCode: cfg.FitbitVerificationCode,
+			ClientSecret:     cfg.FitbitClientSecret,
+			Notify:           func(n fitbit.Notification) { queue.add(n.Date) },
+		})
+	}
+	if cfg.StravaVerifyToken != "" {
+		mux.Handle("/strava/webhook", stravaWebhook(ctx, p, authenticator.Store))
+	}
+	observe(mux, cfg, authenticator)
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	// The worker stops the server if it can't go on.
+	workerErr := make(chan error, 1)
+	go func() {
+		err := syncQueued(ctx, p, queue, *limit, opts, gps)
+		stop()
+		workerErr <- err
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	slog.Info("Listening for notifications", "addr", *addr, "destinations", destination.Names(p.Destinations))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		stop()
+		<-workerErr
+		return reportError(err)
+	}
+	if err := <-workerErr; err != nil {
+		slog.Error("Authorization required; run `fitbit-strava auth`", "error", err)
+		return exitAuth
+	}
+	slog.Info("Server stopped")
+	return exitOK
+}
+
+// syncQueued syncs the queued days as they come in, until ctx is done. A day
+// that fails is queued again after a delay. It returns an error only for a
+// missing or revoked token.
+func syncQueued(ctx context.Context, p *pipeline.Pipeline, queue *dateQueue, limit int, opts pipeline.Options, gps gpsFlags) error {
+	failures := 0
+	seen := make(discoveries)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-queue.ready:
+		}
+		for _, date := range queue.take() {
+			results, err := syncDate(ctx, p, seen, date, limit, opts, gps)
+			observeRun(p, "serve", results, err)
+			if err == nil {
+				failures = 0
+				metrics.LastSuccess.Set(float64(time.Now().Unix()))
+				continue
+			}
+			if exitCodeFor(err) == exitAuth {
+				return err
+			}
+			failures++
+			delay := retryDelay(failures, err)
+			slog.Warn("Sync failed", "date", date, "error", err, "retry_in", delay)
+			time.AfterFunc(delay, func() { queue.add(date) })
+		}
+	}
+}
+
+// syncDate uploads the activities that started on date, YYYY-MM-DD, and
+// aren't synced or skipped yet. Like syncPending, it leaves activities
+// whose device hasn't synced since they ended for a later notification, and
+// returns an error if the
+// activities couldn't be listed or a rate limit or authorization problem
+// cut it short, and the results of the activities it tried either way.
+func syncDate(ctx context.Context, p *pipeline.Pipeline, seen discoveries, date string, limit int, opts pipeline.Options, gps gpsFlags) ([]activityResult, error) {
+	if err := reloadLedger(p); err != nil {
+		return nil, err
+	}
+	recent, err := p.Recent(limit, *gps.include)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent activities: %w", err)
+	}
+	slog.Info("Syncing notified day", "date", date)
+	devices, err := p.Fitbit.GetDevices()
+	if err != nil {
+		slog.Warn("Failed to fetch devices", "error", err)
+	}
+	var results []activityResult
+	// Oldest first, so uploads appear in order.
+	for i := len(recent) - 1; i >= 0; i-- {
+		act := recent[i]
+		// The start time is in the user's time zone, as is Fitbit's date.
+		start, err := pipeline.StartTime(act)
+		if err != nil || start.Format("2006-01-02") != date || p.Synced(act) || p.Skipped(act) != "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return results, nil
+		}
+		if devices != nil && pipeline.WaitingForDevice(act, devices) {
+			slog.Info("Waiting for the device to sync", "name", act.Name, "log_id", act.LogID)
+			continue
+		}
+		seen.add(act)
+		res := syncActivity(p, act, opts, gps)
+		recordSkip(p, act, res, devices)
+		observeActivity(p, "serve", res)
+		results = append(results, res)
+		if code := exitCodeFor(res.err); code == exitAuth || code == exitRateLimited {
+			return results, res.err
+		}
+	}
+	return results, nil
+}
+
+// dateQueue holds the days waiting to be synced. A day notified again
+// before it is taken is only synced once.
+type dateQueue struct {
+	mu    sync.Mutex
+	dates map[string]bool
+	// ready has a value while there are dates to take.
+	ready chan struct{}
+}
+
+func newDateQueue() *dateQueue {
+	return &dateQueue{dates: make(map[string]bool), ready: make(chan struct{}, 1)}
+}
+
+func (q *dateQueue) add(date string) {
+	q.mu.Lock()
+	q.dates[date] = true
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the queue and returns its dates in order.
+func (q *dateQueue) take() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dates := make([]string, 0, len(q.dates))
+	for date := range q.dates {
+		dates = append(dates, date)
+	}
+	clear(q.dates)
+	sort.Strings(dates)
+	return dates
+}
@@ -2,12 +2,16 @@ package strava
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type ActivityMetadata struct {
@@ -16,6 +20,57 @@ type ActivityMetadata struct {
 	ExternalID  string
 }
 
+// SummaryActivity is the part of a listed activity we use.
+type SummaryActivity struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	SportType   string    `json:"sport_type"`
+	StartDate   time.Time `json:"start_date"`
+	ElapsedTime int       `json:"elapsed_time"` // seconds
+	ExternalID  string    `json:"external_id"`
+}
+
+// Activity is the part of a single activity we use.
+type Activity struct {
+	SummaryActivity
+	UploadID string `json:"upload_id_str"`
+}
+
+// UploadStatus is the state of an upload. Strava processes uploads
+// asynchronously; ActivityID is set once it is done, Error if it failed
+// (for example as a duplicate).
+type UploadStatus struct {
+	ID         int64  `json:"id"`
+	IDStr      string `json:"id_str"`
+	ExternalID string `json:"external_id"`
+	Error      string `json:"error"`
+	Status     string `json:"status"`
+	ActivityID int64  `json:"activity_id"`
+}
+
+// APIError is an unsuccessful response from the Strava API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("strava api error: status %s, body %s", e.Status, e.Body)
+}
+
+// RateLimited reports whether the 15-minute or daily request limit was
+// reached.
+func (e *APIError) RateLimited() bool { return e.StatusCode == http.StatusTooManyRequests }
+
+// Unauthorized reports whether the token was rejected or lacks a scope.
+func (e *APIError) Unauthorized() bool { return e.StatusCode == http.StatusUnauthorized }
+
 type Client struct {
 	HttpClient *http.Client
 }
@@ -24,24 +79,55 @@ func NewClient(client *http.Client) *Client {
 	return &Client{HttpClient: client}
 }
 
-func (c *Client) UploadActivity(filename string, metadata ActivityMetadata) (string, error) {
+// DataTypeFor returns the Strava upload data_type for a filename, based on
+// its extension: fit, tcx or gpx, optionally gzipped.
+func DataTypeFor(filename string) (string, error) {
+	name := strings.ToLower(filepath.Base(filename))
+	gz := ""
+	if strings.HasSuffix(name, ".gz") {
+		gz = ".gz"
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	switch ext := strings.TrimPrefix(filepath.Ext(name), "."); ext {
+	case "fit", "tcx", "gpx":
+		return ext + gz, nil
+	default:
+		return "", fmt.Errorf("unsupported upload format: %s", filename)
+	}
+}
+
+// UploadActivity uploads a FIT, TCX or GPX file from disk.
+func (c *Client) UploadActivity(filename string, metadata ActivityMetadata) (*UploadStatus, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
+	return c.Upload(file, filepath.Base(filename), metadata)
+}
+
+// Upload sends activity data to Strava. The data type is derived from
+// filename, which is also the name Strava sees for the upload.
+func (c *Client) Upload(data io.Reader, filename string, metadata ActivityMetadata) (*UploadStatus, error) {
+	dataType, err := DataTypeFor(filename)
+	if err != nil {
+		return nil, err
+	}
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	part, err := writer.CreateFormFile("file", filepath.Base(filename))
+	part, err := writer.CreateFormFile("file", filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to create form file: %v", err)
+		return nil, fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return nil, fmt.Errorf("failed to read activity data: %v", err)
 	}
-	io.Copy(part, file)
 
 	// Add fields
-	writer.WriteField("data_type", "fit")
+	writer.WriteField("data_type", dataType)
 	if metadata.Name != "" {
 		writer.WriteField("name", metadata.Name)
 	}
@@ -54,25 +140,118 @@ func (c *Client) UploadActivity(filename string, metadata ActivityMetadata) (str
 
 	err = writer.Close()
 	if err != nil {
-		return "", fmt.Errorf("failed to close writer: %v", err)
+		return nil, fmt.Errorf("failed to close writer: %v", err)
 	}
 
 	req, err := http.NewRequest("POST", "https://www.strava.com/api/v3/uploads", body)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload: %v", err)
+		return nil, fmt.Errorf("failed to upload: %w", err)
 	}
 	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("strava api error: status %s, body %s", resp.Status, string(respBody))
+		return nil, newAPIError(resp)
 	}
 
-	return string(respBody), nil
+	var status UploadStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode upload response: %v", err)
+	}
+	return &status, nil
+}
+
+// GetUpload returns the current state of an upload.
+func (c *Client) GetUpload(id int64) (*UploadStatus, error) {
+	resp, err := c.HttpClient.Get(fmt.Sprintf("https://www.strava.com/api/v3/uploads/%d", id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var status UploadStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode upload status: %v", err)
+	}
+	return &status, nil
+}
+
+// WaitForUpload polls an upload until Strava has created the activity or
+// rejected the file, or until timeout. It returns the last status seen, and
+// an error if the upload was rejected.
+func (c *Client) WaitForUpload(status *UploadStatus, timeout time.Duration) (*UploadStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for status.ActivityID == 0 && status.Error == "" && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		next, err := c.GetUpload(status.ID)
+		if err != nil {
+			return status, err
+		}
+		status = next
+		slog.Debug("Strava upload status", "upload_id", status.IDStr, "status", status.Status, "activity_id", status.ActivityID)
+	}
+	if status.Error != "" {
+		return status, fmt.Errorf("strava rejected the upload: %s", status.Error)
+	}
+	return status, nil
+}
+
+// GetActivity returns one of the athlete's activities.
+func (c *Client) GetActivity(id int64) (*Activity, error) {
+	resp, err := c.HttpClient.Get(fmt.Sprintf("https://www.strava.com/api/v3/activities/%d", id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activity: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var activity Activity
+	if err := json.NewDecoder(resp.Body).Decode(&activity); err != nil {
+		return nil, fmt.Errorf("failed to decode activity: %v", err)
+	}
+	return &activity, nil
+}
+
+// ListActivities returns the athlete's activities that started between
+// after and before. Private activities are only listed with the
+// activity:read_all scope.
+func (c *Client) ListActivities(after, before time.Time) ([]SummaryActivity, error) {
+	const perPage = 100
+	var activities []SummaryActivity
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://www.strava.com/api/v3/athlete/activities?after=%d&before=%d&page=%d&per_page=%d",
+			after.Unix(), before.Unix(), page, perPage)
+		resp, err := c.HttpClient.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list activities: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := newAPIError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		var batch []SummaryActivity
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("failed to decode activities: %v", err)
+		}
+		activities = append(activities, batch...)
+		if len(batch) < perPage {
+			return activities, nil
+		}
+	}
 }
@@ -0,0 +1,119 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const pushSubscriptionsURL = "https://www.strava.com/api/v3/push_subscriptions"
+
+// PushSubscription has Strava send events about the app's athletes to a
+// callback URL. An app can have only one.
+type PushSubscription struct {
+	ID          int64     `json:"id"`
+	CallbackURL string    `json:"callback_url"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+// Event is a webhook event. ObjectType is "activity" or "athlete" and
+// AspectType "create", "update" or "delete". Updates holds the changed
+// fields of an update, such as "title", "type" and "private", or
+// "authorized": "false" when the athlete revokes the app's access.
+type Event struct {
+	ObjectType     string         `json:"object_type"`
+	ObjectID       int64          `json:"object_id"`
+	AspectType     string         `json:"aspect_type"`
+	Updates        map[string]any `json:"updates"`
+	OwnerID        int64          `json:"owner_id"`
+	SubscriptionID int64          `json:"subscription_id"`
+	EventTime      int64          `json:"event_time"`
+}
+
+// Update returns a changed field of an update event as a string, or "".
+func (e Event) Update(field string) string {
+	v, ok := e.Updates[field]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Deauthorized reports whether the event is the athlete revoking the app's
+// access.
+func (e Event) Deauthorized() bool {
+	return e.ObjectType == "athlete" && e.Update("authorized") == "false"
+}
+
+// Push subscriptions belong to the app, so these calls authenticate with
+// the client credentials rather than an athlete's token.
+
+// CreatePushSubscription subscribes callbackURL to events. Strava checks
+// the callback by sending it verifyToken before answering.
+func (c *Client) CreatePushSubscription(clientID, clientSecret, callbackURL, verifyToken string) (int64, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"callback_url":  {callbackURL},
+		"verify_token":  {verifyToken},
+	}
+	resp, err := c.HttpClient.Post(pushSubscriptionsURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create push subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return 0, newAPIError(resp)
+	}
+
+	var sub PushSubscription
+	if err := json.NewDecoder(resp.Body).Decode(&sub); err != nil {
+		return 0, fmt.Errorf("failed to decode push subscription: %v", err)
+	}
+	return sub.ID, nil
+}
+
+// ListPushSubscriptions returns the app's push subscription, if any.
+func (c *Client) ListPushSubscriptions(clientID, clientSecret string) ([]PushSubscription, error) {
+	query := url.Values{"client_id": {clientID}, "client_secret": {clientSecret}}
+	resp, err := c.HttpClient.Get(pushSubscriptionsURL + "?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var subs []PushSubscription
+	if err := json.NewDecoder(resp.Body).Decode(&subs); err != nil {
+		return nil, fmt.Errorf("failed to decode push subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// DeletePushSubscription removes the push subscription id.
+func (c *Client) DeletePushSubscription(clientID, clientSecret string, id int64) error {
+	query := url.Values{"client_id": {clientID}, "client_secret": {clientSecret}}
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%d?%s", pushSubscriptionsURL, id, query.Encode()), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp)
+	}
+	return nil
+}
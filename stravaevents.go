@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"fitbit-strava/auth"
+	"fitbit-strava/destination"
+	"fitbit-strava/ledger"
+	"fitbit-strava/pipeline"
+	"fitbit-strava/strava"
+	"fitbit-strava/webhook"
+)
+
+// applyStravaEvent brings the ledger in line with a change made on Strava.
+// A new activity completes an upload that was still processing; a rename
+// or deletion is noted against the upload, so a deleted activity isn't
+// uploaded again. Revoked access deletes the Strava token and is recorded,
+// so Strava requests fail, in this process and others, and /healthz is
+// unhealthy until `fitbit-strava auth strava`. client looks up new
+// activities and may be nil.
+func applyStravaEvent(book *ledger.Ledger, client *strava.Client, store *auth.TokenStore, ev strava.Event) error {
+	if ev.Deauthorized() {
+		slog.Warn("Strava access was revoked; run `fitbit-strava auth strava` to upload to Strava again", "athlete", ev.OwnerID)
+		if err := store.Revoke("strava"); err != nil {
+			return fmt.Errorf("failed to record revoked strava access: %v", err)
+		}
+		return nil
+	}
+	if ev.ObjectType != "activity" {
+		return nil
+	}
+
+	id := strconv.FormatInt(ev.ObjectID, 10)
+	switch ev.AspectType {
+	case "create":
+		return completeStravaUpload(book, client, ev.ObjectID)
+	case "update":
+		title := ev.Update("title")
+		if title == "" {
+			return nil
+		}
+		return updateStravaUpload(book, id, "Strava activity renamed", func(u *ledger.Upload) { u.Name = title })
+	case "delete":
+		deleted := time.Unix(ev.EventTime, 0)
+		return updateStravaUpload(book, id, "Strava activity deleted", func(u *ledger.Upload) { u.DeletedAt = deleted })
+	}
+	return nil
+}
+
+// completeStravaUpload records the activity id of an upload that was still
+// processing when it was recorded. The activity is matched on its upload
+// id, or on the external id the upload was given, which is the ledger key.
+func completeStravaUpload(book *ledger.Ledger, client *strava.Client, activityID int64) error {
+	if client == nil {
+		return nil
+	}
+	act, err := client.GetActivity(activityID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch strava activity %d: %w", activityID, err)
+	}
+
+	key := ""
+	if act.UploadID != "" {
+		key = book.Find("strava", func(u ledger.Upload) bool { return u.UploadID == act.UploadID })
+	}
+	if key == "" {
+		key = strings.TrimSuffix(act.ExternalID, path.Ext(act.ExternalID))
+	}
+	id := strconv.FormatInt(activityID, 10)
+	ok, err := book.Update(key, "strava", func(u *ledger.Upload) {
+		if u.ID == "" {
+			u.ID = id
+			u.URL = "https://www.strava.com/activities/" + id
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update sync ledger: %v", err)
+	}
+	if ok {
+		slog.Info("Strava activity created", "source", key, "id", id)
+	}
+	return nil
+}
+
+// updateStravaUpload changes the ledger's record of the upload that became
+// Strava activity id. Activities that weren't uploaded by us are ignored.
+func updateStravaUpload(book *ledger.Ledger, id, msg string, update func(*ledger.Upload)) error {
+	key := book.Find("strava", func(u ledger.Upload) bool { return u.ID == id })
+	if key == "" {
+		slog.Debug("Ignoring event for an activity not in the ledger", "id", id)
+		return nil
+	}
+	if _, err := book.Update(key, "strava", update); err != nil {
+		return fmt.Errorf("failed to update sync ledger: %v", err)
+	}
+	slog.Info(msg, "source", key, "id", id)
+	return nil
+}
+
+// stravaWebhook returns the handler for Strava's events, which are applied
+// in the background until ctx is done.
+func stravaWebhook(ctx context.Context, p *pipeline.Pipeline, store *auth.TokenStore) *webhook.Strava {
+	cfg := p.Config
+	var client *strava.Client
+	for _, d := range p.Destinations {
+		if s, ok := d.(*destination.Strava); ok {
+			client = s.Client
+		}
+	}
+
+	h := &webhook.Strava{VerifyToken: cfg.StravaVerifyToken}
+	// Only accept events for the app's own subscription, once there is one.
+	subs, err := strava.NewClient(loggingClient("strava")).ListPushSubscriptions(cfg.StravaClientID, cfg.StravaClientSecret)
+	if err != nil {
+		slog.Warn("Failed to look up the Strava push subscription", "error", err)
+	} else if len(subs) > 0 {
+		h.SubscriptionID = subs[0].ID
+	}
+
+	events := make(chan strava.Event, 100)
+	h.Handle = func(ev strava.Event) {
+		select {
+		case events <- ev:
+		default:
+			slog.Warn("Dropped Strava event, too many queued", "object", ev.ObjectType, "id", ev.ObjectID, "aspect", ev.AspectType)
+		}
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-events:
+				if err := applyStravaEvent(p.Ledger, client, store, ev); err != nil {
+					slog.Warn("Failed to apply Strava event", "object", ev.ObjectType, "id", ev.ObjectID, "aspect", ev.AspectType, "error", err)
+				}
+			}
+		}
+	}()
+	return h
+}
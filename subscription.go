@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"fitbit-strava/config"
+	"fitbit-strava/fitbit"
+	"fitbit-strava/strava"
+)
+
+// runSubscription implements `fitbit-strava subscription add|list|delete`:
+// manage the Fitbit subscription that has Fitbit notify `fitbit-strava
+// serve` of new activities, or with -strava the app's Strava push
+// subscription.
+func runSubscription(args []string) int {
+	fs := flag.NewFlagSet("subscription", flag.ExitOnError)
+	id := fs.String("id", "activities", "Subscription id, unique for the user")
+	useStrava := fs.Bool("strava", false, "Manage the Strava push subscription instead")
+	callback := fs.String("callback", "", "With -strava add, the public URL of serve's /strava/webhook")
+	output := outputFlag(fs, "the subscriptions added, listed or deleted as a JSON array")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava subscription [flags] add|list|delete")
+		fmt.Fprintln(os.Stderr, "The subscriber is FITBIT_SUBSCRIBER_ID, or the app's default subscriber.")
+		fmt.Fprintln(os.Stderr, "With -strava, serve must be running at -callback while adding.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkOutput(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	asJSON := *output == "json"
+	if *useStrava {
+		return runStravaSubscription(fs, *callback, asJSON)
+	}
+
+	p := setupFitbit()
+	subscriber := p.Config.FitbitSubscriberID
+
+	switch fs.Arg(0) {
+	case "add":
+		sub, err := p.Fitbit.AddSubscription(*id, subscriber)
+		if err != nil {
+			return reportError(err)
+		}
+		if asJSON {
+			return printSubscriptions([]fitbit.Subscription{*sub})
+		}
+		fmt.Printf("Subscribed to %s as %q (subscriber %s)\n", sub.CollectionType, sub.SubscriptionID, sub.SubscriberID)
+	case "list":
+		subs, err := p.Fitbit.ListSubscriptions()
+		if err != nil {
+			return reportError(err)
+		}
+		if asJSON {
+			return printSubscriptions(subs)
+		}
+		if len(subs) == 0 {
+			fmt.Println("No subscriptions.")
+			return exitOK
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCOLLECTION\tSUBSCRIBER\tOWNER")
+		for _, s := range subs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.SubscriptionID, s.CollectionType, s.SubscriberID, s.OwnerID)
+		}
+		tw.Flush()
+	case "delete":
+		if err := p.Fitbit.DeleteSubscription(*id, subscriber); err != nil {
+			return reportError(err)
+		}
+		if asJSON {
+			return printSubscriptions([]fitbit.Subscription{{SubscriptionID: *id, SubscriberID: subscriber}})
+		}
+		fmt.Printf("Deleted subscription %q\n", *id)
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// runStravaSubscription manages the app's Strava push subscription. Strava
+// allows one per app, so delete removes whichever there is.
+func runStravaSubscription(fs *flag.FlagSet, callback string, asJSON bool) int {
+	cfg, err := config.Load()
+	if err != nil {
+		return reportError(fmt.Errorf("failed to load config: %v", err))
+	}
+	if cfg.StravaClientID == "" || cfg.StravaClientSecret == "" {
+		return reportError(fmt.Errorf("missing Strava credentials in .env"))
+	}
+	client := strava.NewClient(loggingClient("strava"))
+
+	switch fs.Arg(0) {
+	case "add":
+		if callback == "" || cfg.StravaVerifyToken == "" {
+			return reportError(fmt.Errorf("adding a Strava subscription needs -callback and STRAVA_WEBHOOK_VERIFY_TOKEN in .env"))
+		}
+		id, err := client.CreatePushSubscription(cfg.StravaClientID, cfg.StravaClientSecret, callback, cfg.StravaVerifyToken)
+		if err != nil {
+			return reportError(err)
+		}
+		if asJSON {
+			return printSubscriptions([]strava.PushSubscription{{ID: id, CallbackURL: callback}})
+		}
+		fmt.Printf("Subscribed %s as Strava push subscription %d\n", callback, id)
+	case "list", "delete":
+		subs, err := client.ListPushSubscriptions(cfg.StravaClientID, cfg.StravaClientSecret)
+		if err != nil {
+			return reportError(err)
+		}
+		if fs.Arg(0) == "delete" {
+			for _, s := range subs {
+				if err := client.DeletePushSubscription(cfg.StravaClientID, cfg.StravaClientSecret, s.ID); err != nil {
+					return reportError(err)
+				}
+				if !asJSON {
+					fmt.Printf("Deleted Strava push subscription %d\n", s.ID)
+				}
+			}
+		}
+		if asJSON {
+			return printSubscriptions(subs)
+		}
+		if len(subs) == 0 {
+			fmt.Println("No subscriptions.")
+			return exitOK
+		}
+		if fs.Arg(0) == "delete" {
+			return exitOK
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCALLBACK\tCREATED")
+		for _, s := range subs {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.ID, s.CallbackURL, s.CreatedAt.Local().Format("2006-01-02 15:04"))
+		}
+		tw.Flush()
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// printSubscriptions prints subs as a JSON array for -output json.
+func printSubscriptions[S any](subs []S) int {
+	if subs == nil {
+		subs = []S{}
+	}
+	if err := printJSON(subs); err != nil {
+		return reportError(err)
+	}
+	return exitOK
+}
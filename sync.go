@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"fitbit-strava/fitbit"
+	"fitbit-strava/pipeline"
+)
+
+// runSync implements `fitbit-strava sync`: upload the recent activities
+// the ledger has no record of, without prompting. -log-id or -start sync
+// one activity instead.
+func runSync(args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	days := fs.Int("days", 7, "Only sync activities that started in the last this many days")
+	limit := fs.Int("limit", 20, "Look at this many of the most recent activities")
+	logID := fs.Int64("log-id", 0, "Sync this Fitbit activity, even if it was synced before")
+	window := newWindowFlags(fs)
+	encode := newEncodeFlags(fs)
+	gps := newGPSFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "List what would be synced without fetching or uploading")
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava sync [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	opts, err := encode.options()
+	if err != nil {
+		return report.fail(err)
+	}
+
+	p := setupPipeline()
+	report.notify = p.Notify
+
+	if window.set() {
+		win, err := window.window()
+		if err != nil {
+			return report.fail(err)
+		}
+		res := activityResult{StartTime: win.Start}
+		if *dryRun {
+			report.textf("Would sync %s %s (%s)\n", win.Date(), win.Start.Format("15:04"), win.Duration)
+			res.Status = statusPending
+			report.add(res)
+			return report.finish()
+		}
+		act, err := buildActivity(p, nil, win, opts, gps)
+		if err != nil {
+			return report.failActivity(res, err)
+		}
+		res.Name = act.Name
+		report.add(res.uploaded(p.Upload(act)))
+		return report.finish()
+	}
+
+	var pending []fitbit.ActivityLog
+	if *logID != 0 {
+		act, err := findActivity(p, *logID)
+		if err != nil {
+			return report.fail(err)
+		}
+		pending = append(pending, *act)
+	} else {
+		pending, err = p.Pending(*limit, *days, *gps.include)
+		if err != nil {
+			return report.fail(fmt.Errorf("failed to fetch recent activities: %w", err))
+		}
+	}
+	if len(pending) == 0 {
+		report.textf("Nothing to sync.\n")
+		return exitNothingToDo
+	}
+
+	failed := 0
+	// Oldest first, so uploads appear in order.
+	for i := len(pending) - 1; i >= 0; i-- {
+		act := pending[i]
+		if *dryRun {
+			res := activityResult{LogID: act.LogID, Name: act.Name, Status: statusPending}
+			res.StartTime, _ = pipeline.StartTime(act)
+			report.textf("%s %s (%dm)\n", res.StartTime.Format("2006-01-02 15:04"), act.Name, act.Duration/60000)
+			report.add(res)
+			continue
+		}
+		res := syncActivity(p, act, opts, gps)
+		if res.Status != statusUploaded && res.Status != statusSkipped {
+			failed++
+		}
+		report.add(res)
+	}
+
+	if *dryRun {
+		report.textf("Would sync %d activities.\n", len(pending))
+	} else {
+		report.textf("Synced %d of %d activities.\n", len(pending)-failed, len(pending))
+	}
+	return report.finish()
+}
+
+// syncActivity fetches, encodes and uploads one logged activity.
+func syncActivity(p *pipeline.Pipeline, act fitbit.ActivityLog, opts pipeline.Options, gps gpsFlags) activityResult {
+	res := activityResult{LogID: act.LogID, Name: act.Name}
+	win, err := pipeline.WindowFor(act)
+	if err != nil {
+		slog.Warn("Invalid activity", "name", act.Name, "log_id", act.LogID, "error", err)
+		return res.failed(err)
+	}
+	res.StartTime = win.Start
+	slog.Info("Syncing", "name", act.Name, "log_id", act.LogID, "start", win.Start, "duration", win.Duration)
+
+	upload, err := buildActivity(p, &act, win, opts, gps)
+	if errors.Is(err, pipeline.ErrNoHeartRate) || errors.Is(err, pipeline.ErrSkipped) {
+		slog.Info("Skipping activity", "name", act.Name, "log_id", act.LogID, "reason", err)
+		return res.failed(err)
+	}
+	if err != nil {
+		slog.Warn("Failed to build activity", "name", act.Name, "log_id", act.LogID, "error", err)
+		return res.failed(err)
+	}
+	return res.uploaded(p.Upload(upload))
+}
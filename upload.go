@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fitbit-strava/destination"
+	"fitbit-strava/encoder"
+)
+
+// runUpload implements `fitbit-strava upload <file>`: send an existing
+// activity file to the destinations, e.g. one written by export or
+// pick -dry-run.
+func runUpload(args []string) int {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	name := fs.String("name", "", "Activity name (default: the destination's own)")
+	sport := fs.String("sport", "", "Activity type, e.g. Spinning, for archive file names")
+	description := fs.String("description", "", "Activity description")
+	externalID := fs.String("external-id", "", "Source id, e.g. fitbit-1234, to match the upload in the ledger")
+	report := newReporter(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fitbit-strava upload [flags] <file.fit|file.tcx|file.gpx>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := report.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	path := fs.Arg(0)
+	res := activityResult{File: path, Name: *name}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report.failActivity(res, err)
+	}
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if encoder.IsFIT(data) {
+		format = "fit"
+	}
+	if _, err := encoder.ParseFormat(format); err != nil {
+		return report.failActivity(res, err)
+	}
+
+	act := destination.Activity{
+		Data:        data,
+		Format:      format,
+		Name:        *name,
+		Sport:       *sport,
+		Description: *description,
+		ExternalID:  *externalID,
+	}
+	if start, _, err := encoder.Span(data); err == nil {
+		act.StartTime = start
+	} else if info, err := os.Stat(path); err == nil {
+		// GPX isn't parsed; the file time is the best guess.
+		act.StartTime = info.ModTime()
+	}
+
+	res.StartTime = act.StartTime
+
+	p := setupPipeline()
+	report.notify = p.Notify
+	res = res.uploaded(p.Upload(act))
+	if res.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", res.err)
+	}
+	report.add(res)
+	return report.finish()
+}
@@ -0,0 +1,96 @@
+// Package webdav is a minimal WebDAV client (Nextcloud, ownCloud, Apache
+// mod_dav, rclone serve webdav, ...) that uploads files with PUT, creating
+// missing collections on the way.
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	HttpClient *http.Client
+	// BaseURL is the collection files are stored under, e.g.
+	// https://cloud.example.com/remote.php/dav/files/alice/Workouts
+	BaseURL  string
+	Username string
+	Password string
+}
+
+func NewClient(client *http.Client, baseURL, username, password string) *Client {
+	return &Client{
+		HttpClient: client,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Username:   username,
+		Password:   password,
+	}
+}
+
+// Put stores data at path, relative to BaseURL, and returns the file URL.
+// Parent collections are created as needed; an existing file is replaced.
+func (c *Client) Put(path string, data []byte, contentType string) (string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	collection := c.BaseURL
+	for _, dir := range segments[:len(segments)-1] {
+		collection += "/" + dir
+		if err := c.mkcol(collection + "/"); err != nil {
+			return "", err
+		}
+	}
+	fileURL := collection + "/" + segments[len(segments)-1]
+
+	req, err := http.NewRequest("PUT", fileURL, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent, http.StatusOK:
+		return fileURL, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return "", fmt.Errorf("webdav error: status %s, body %s", resp.Status, string(body))
+}
+
+// mkcol creates a collection. A 405 means it already exists.
+func (c *Client) mkcol(collectionURL string) error {
+	req, err := http.NewRequest("MKCOL", collectionURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed:
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("webdav error creating %s: status %s, body %s", collectionURL, resp.Status, string(body))
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return c.HttpClient.Do(req)
+}
@@ -0,0 +1,122 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// server is a WebDAV server that keeps collections and files in memory and
+// records the requests it gets.
+type server struct {
+	mu          sync.Mutex
+	collections map[string]bool
+	files       map[string]string
+	requests    []string
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	t.Helper()
+	s := &server{collections: map[string]bool{"/dav/": true}, files: make(map[string]string)}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.EscapedPath()
+	s.requests = append(s.requests, r.Method+" "+path)
+	if user, pass, _ := r.BasicAuth(); user != "alice" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parent := path[:strings.LastIndex(strings.TrimSuffix(path, "/"), "/")+1]
+
+	switch r.Method {
+	case "MKCOL":
+		switch {
+		case s.collections[path]:
+			// RFC 4918: MKCOL on an existing collection is 405.
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !s.collections[parent]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			s.collections[path] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "PUT":
+		if !s.collections[parent] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, exists := s.files[path]
+		s.files[path] = string(body)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPutCreatesCollections(t *testing.T) {
+	s, srv := newServer(t)
+	c := NewClient(srv.Client(), srv.URL+"/dav/", "alice", "secret")
+
+	got, err := c.Put("/2024/05/Evening workout.fit", []byte("fit data"), "application/vnd.ant.fit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/dav/2024/05/Evening%20workout.fit"; got != want {
+		t.Errorf("Put = %s, want %s", got, want)
+	}
+	wantRequests := []string{
+		"MKCOL /dav/2024/",
+		"MKCOL /dav/2024/05/",
+		"PUT /dav/2024/05/Evening%20workout.fit",
+	}
+	if !reflect.DeepEqual(s.requests, wantRequests) {
+		t.Errorf("requests %q, want %q", s.requests, wantRequests)
+	}
+	if s.files["/dav/2024/05/Evening%20workout.fit"] != "fit data" {
+		t.Errorf("stored files %v", s.files)
+	}
+}
+
+func TestPutExistingCollections(t *testing.T) {
+	s, srv := newServer(t)
+	c := NewClient(srv.Client(), srv.URL+"/dav", "alice", "secret")
+
+	if _, err := c.Put("2024/05/a.fit", []byte("a"), ""); err != nil {
+		t.Fatal(err)
+	}
+	s.requests = nil
+	// The collections exist now, so each MKCOL is answered with 405.
+	if _, err := c.Put("2024/05/b.fit", []byte("b"), ""); err != nil {
+		t.Fatalf("Put with existing collections: %v", err)
+	}
+	if len(s.requests) != 3 || s.files["/dav/2024/05/b.fit"] != "b" {
+		t.Errorf("requests %q, files %v", s.requests, s.files)
+	}
+	// Replacing a file is fine too.
+	if _, err := c.Put("2024/05/b.fit", []byte("b2"), ""); err != nil {
+		t.Fatalf("Put over an existing file: %v", err)
+	}
+}
+
+func TestPutErrors(t *testing.T) {
+	_, srv := newServer(t)
+	c := NewClient(srv.Client(), srv.URL+"/dav", "alice", "wrong")
+	if _, err := c.Put("2024/a.fit", []byte("a"), ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Put with bad credentials: %v, want a 401 error", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package webhook receives push notifications from Fitbit and Strava.
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"fitbit-strava/fitbit"
+)
+
+// maxBody caps the size of a notification.
+const maxBody = 1 << 20
+
+// Fitbit handles the subscriber endpoint of a Fitbit app. GET requests are
+// Fitbit verifying the endpoint; POSTs carry notifications, which must be
+// answered within 5 seconds, so Notify should only queue the work.
+type Fitbit struct {
+	// VerificationCode is the code shown for the subscriber in the app
+	// settings at dev.fitbit.com.
+	VerificationCode string
+	// ClientSecret signs the notifications.
+	ClientSecret string
+	// Notify is called for each notification about activities.
+	Notify func(fitbit.Notification)
+}
+
+func (h *Fitbit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.verify(w, r)
+	case http.MethodPost:
+		h.notify(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify answers Fitbit's check that the endpoint belongs to the app: 204
+// for the right code, 404 for a wrong one.
+func (h *Fitbit) verify(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("verify")
+	if code == "" || h.VerificationCode == "" || subtle.ConstantTimeCompare([]byte(code), []byte(h.VerificationCode)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	slog.Info("Fitbit subscriber verified")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Fitbit) notify(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	// Fitbit's advice is to answer a bad signature with 404, which also
+	// tells a probe nothing.
+	if !fitbit.ValidSignature(body, r.Header.Get("X-Fitbit-Signature"), h.ClientSecret) {
+		slog.Warn("Rejected Fitbit notification with an invalid signature", "remote", r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+
+	var notifications []fitbit.Notification
+	if err := json.Unmarshal(body, &notifications); err != nil {
+		slog.Warn("Invalid Fitbit notification", "error", err)
+		http.Error(w, "invalid notification", http.StatusBadRequest)
+		return
+	}
+	for _, n := range notifications {
+		slog.Debug("Fitbit notification", "collection", n.CollectionType, "date", n.Date, "subscription", n.SubscriptionID)
+		if n.CollectionType == "activities" && n.Date != "" {
+			h.Notify(n)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fitbit-strava/fitbit"
+)
+
+// sign signs body the way Fitbit does, with HMAC-SHA1 keyed by key.
+func sign(body, key string) string {
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newFitbitServer(t *testing.T) (*httptest.Server, *[]fitbit.Notification) {
+	t.Helper()
+	var got []fitbit.Notification
+	h := &Fitbit{
+		VerificationCode: "verify-me",
+		ClientSecret:     "s3cret",
+		Notify:           func(n fitbit.Notification) { got = append(got, n) },
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestFitbitVerify(t *testing.T) {
+	srv, _ := newFitbitServer(t)
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"?verify=verify-me", http.StatusNoContent},
+		{"?verify=wrong", http.StatusNotFound},
+		{"", http.StatusNotFound},
+	} {
+		resp, err := http.Get(srv.URL + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("GET %q: status %d, want %d", tc.query, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+const fitbitBody = `[{"collectionType":"activities","date":"2024-05-01","ownerId":"ABC","ownerType":"user","subscriptionId":"1"},` +
+	`{"collectionType":"sleep","date":"2024-05-01","ownerId":"ABC","ownerType":"user","subscriptionId":"1"}]`
+
+func postFitbit(t *testing.T, url, signature string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(fitbitBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Fitbit-Signature", signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestFitbitNotification(t *testing.T) {
+	srv, got := newFitbitServer(t)
+	// The key is the client secret followed by "&".
+	if status := postFitbit(t, srv.URL, sign(fitbitBody, "s3cret&")); status != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", status, http.StatusNoContent)
+	}
+	if len(*got) != 1 || (*got)[0].CollectionType != "activities" || (*got)[0].Date != "2024-05-01" {
+		t.Errorf("notified %+v, want the activities notification only", *got)
+	}
+}
+
+func TestFitbitBadSignature(t *testing.T) {
+	srv, got := newFitbitServer(t)
+	for name, signature := range map[string]string{
+		"missing":      "",
+		"not base64":   "!!!",
+		"wrong secret": sign(fitbitBody, "other&"),
+		"without &":    sign(fitbitBody, "s3cret"),
+	} {
+		if status := postFitbit(t, srv.URL, signature); status != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", name, status, http.StatusNotFound)
+		}
+	}
+	if len(*got) != 0 {
+		t.Errorf("notified %+v for badly signed requests", *got)
+	}
+}
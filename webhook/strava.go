@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"fitbit-strava/strava"
+)
+
+// Strava handles the callback URL of a Strava push subscription. GET
+// requests are Strava validating the callback; POSTs carry events, which
+// must be answered within 2 seconds, so Handle should only queue the work.
+type Strava struct {
+	// VerifyToken is the token given when creating the subscription.
+	VerifyToken string
+	// SubscriptionID, if set, is the only subscription whose events are
+	// accepted. Strava doesn't sign events, so this keeps out the obvious
+	// forgeries.
+	SubscriptionID int64
+	// Handle is called for each event.
+	Handle func(strava.Event)
+}
+
+func (h *Strava) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.validate(w, r)
+	case http.MethodPost:
+		h.event(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validate answers Strava's challenge, echoing hub.challenge if
+// hub.verify_token is ours.
+func (h *Strava) validate(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := q.Get("hub.verify_token")
+	if q.Get("hub.mode") != "subscribe" || token == "" || h.VerifyToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.VerifyToken)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	slog.Info("Strava callback validated")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"hub.challenge": q.Get("hub.challenge")})
+}
+
+func (h *Strava) event(w http.ResponseWriter, r *http.Request) {
+	var ev strava.Event
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&ev); err != nil {
+		slog.Warn("Invalid Strava event", "error", err)
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	if h.SubscriptionID != 0 && ev.SubscriptionID != h.SubscriptionID {
+		slog.Warn("Rejected Strava event for another subscription", "subscription", ev.SubscriptionID, "remote", r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+	slog.Debug("Strava event", "object", ev.ObjectType, "id", ev.ObjectID, "aspect", ev.AspectType, "updates", ev.Updates)
+	h.Handle(ev)
+	w.WriteHeader(http.StatusOK)
+}
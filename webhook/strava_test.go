@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"fitbit-strava/strava"
+)
+
+func newStravaServer(t *testing.T) (*httptest.Server, *[]strava.Event) {
+	t.Helper()
+	var got []strava.Event
+	h := &Strava{
+		VerifyToken:    "token",
+		SubscriptionID: 120475,
+		Handle:         func(ev strava.Event) { got = append(got, ev) },
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestStravaChallenge(t *testing.T) {
+	srv, _ := newStravaServer(t)
+	q := url.Values{"hub.mode": {"subscribe"}, "hub.verify_token": {"token"}, "hub.challenge": {"15f7d1a91c1f40f8a748fd134752feb3"}}
+	resp, err := http.Get(srv.URL + "?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["hub.challenge"] != "15f7d1a91c1f40f8a748fd134752feb3" {
+		t.Errorf("echoed %v, want the challenge", body)
+	}
+}
+
+func TestStravaChallengeWrongToken(t *testing.T) {
+	srv, _ := newStravaServer(t)
+	for _, q := range []url.Values{
+		{"hub.mode": {"subscribe"}, "hub.verify_token": {"wrong"}, "hub.challenge": {"x"}},
+		{"hub.mode": {"subscribe"}, "hub.challenge": {"x"}},
+		{"hub.mode": {"unsubscribe"}, "hub.verify_token": {"token"}, "hub.challenge": {"x"}},
+	} {
+		resp, err := http.Get(srv.URL + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: status %d, want %d", q, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+}
+
+func TestStravaEvent(t *testing.T) {
+	srv, got := newStravaServer(t)
+	post := func(body string) int {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	body := `{"aspect_type":"update","event_time":1516126040,"object_id":1360128428,"object_type":"activity",` +
+		`"owner_id":134815,"subscription_id":120475,"updates":{"title":"Messy"}}`
+	if status := post(body); status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("handled %d events, want 1", len(*got))
+	}
+	if ev := (*got)[0]; ev.ObjectID != 1360128428 || ev.AspectType != "update" || ev.Update("title") != "Messy" {
+		t.Errorf("handled %+v", ev)
+	}
+
+	if status := post(strings.Replace(body, "120475", "999", 1)); status != http.StatusNotFound {
+		t.Errorf("other subscription: status %d, want %d", status, http.StatusNotFound)
+	}
+	if status := post("not json"); status != http.StatusBadRequest {
+		t.Errorf("invalid body: status %d, want %d", status, http.StatusBadRequest)
+	}
+	if len(*got) != 1 {
+		t.Errorf("handled %d events, want only the valid one", len(*got))
+	}
+}